@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the response net/rpc sends once a client has connected over HTTP
+const rpcConnected = "200 Connected to Go RPC"
+
+// Where a watch server listening on TCP keeps the token clients have to present
+func tokenPath() string {
+	return filepath.Join(runtimeDir(), "token")
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Write the token to a file only the user can read, so only the user's clients can connect
+func writeToken(path, token string) error {
+	if err := privateDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(token), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Read the token, a missing file gives a blank token which the server will turn away
+func readToken(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// The token a client presents to a watch server on TCP. The one the local server wrote to the runtime dir is only sent
+// to this host, as any other would learn it; a server elsewhere gets the token from --token-file, if one is given
+func clientToken(network, address string, tf TLSFiles) string {
+	if network != "tcp" || (tf.Token == "" && !isLoopback(address)) {
+		return ""
+	}
+
+	return readToken(tf.tokenFile())
+}
+
+/*
+The token a watch server on TCP wants from clients. A token file given with --token-file can be shared with clients
+on other hosts, so the token already in it is kept; otherwise, or if it doesn't hold one, a new token is written to it
+*/
+func serverToken(path string, shared bool) (string, error) {
+	if shared {
+		if token := readToken(path); token != "" {
+			return token, nil
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %s", err)
+	}
+	if err := writeToken(path, token); err != nil {
+		return "", fmt.Errorf("failed to write token: %s", err)
+	}
+
+	return token, nil
+}
+
+// Remove the token file, as long as it still holds the token (another server may have replaced it since)
+func removeToken(path, token string) {
+	if readToken(path) != token {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.WithField("path", path).WithField("error", err).Error("failed to remove token file")
+	}
+}
+
+// Turn away any request that doesn't carry the token. A blank token means the server doesn't need one,
+// e.g. because it's on a socket only the user can connect to
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Connect to an RPC server over HTTP, like rpc.DialHTTPPath does but optionally over TLS, presenting the token (if any)
+// when connecting. Every call the client makes goes over the connection the token was accepted on
+func dialHTTP(network, address, path, token string, tlsConfig *tls.Config) (*rpc.Client, error) {
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.Dial(network, address, tlsConfig)
+	} else {
+		conn, err = net.Dial(network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req := "CONNECT " + path + " HTTP/1.0\n"
+	if token != "" {
+		req += "Authorization: Bearer " + token + "\n"
+	}
+	io.WriteString(conn, req+"\n")
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err == nil && resp.Status == rpcConnected {
+		return rpc.NewClient(conn), nil
+	}
+	if err == nil {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	conn.Close()
+
+	return nil, &net.OpError{
+		Op:   "dial-http",
+		Net:  network + " " + address,
+		Addr: nil,
+		Err:  err,
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "run", "token")
+
+	token, err := newToken()
+	assert.NoError(t, err)
+	assert.Equal(t, 64, len(token))
+	other, _ := newToken()
+	assert.NotEqual(t, token, other)
+
+	assert.NoError(t, writeToken(path, token))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.Equal(t, token, readToken(path))
+	assert.Equal(t, "", readToken(filepath.Join(dir, "missing")))
+}
+
+func TestServerToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token")
+
+	// a shared token file gets a token on first use, which is kept from then on
+	token, err := serverToken(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, token, readToken(path))
+	again, err := serverToken(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, token, again)
+
+	// the server's own token file gets a new token every time
+	other, err := serverToken(path, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+	assert.Equal(t, other, readToken(path))
+}
+
+func TestClientToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+	assert.NoError(t, writeToken(tokenPath(), "local"))
+	shared := filepath.Join(dir, "shared")
+	assert.NoError(t, writeToken(shared, "shared"))
+
+	assert.Equal(t, "local", clientToken("tcp", "localhost:33033", TLSFiles{}))
+	assert.Equal(t, "local", clientToken("tcp", "127.0.0.1:33033", TLSFiles{}))
+	// the local server's token isn't handed to another host
+	assert.Equal(t, "", clientToken("tcp", "10.0.0.7:33033", TLSFiles{}))
+	assert.Equal(t, "shared", clientToken("tcp", "10.0.0.7:33033", TLSFiles{Token: shared}))
+	assert.Equal(t, "", clientToken("unix", filepath.Join(dir, "watch.sock"), TLSFiles{}))
+}
+
+func TestRequireToken(t *testing.T) {
+	once.Do(setupRPC)
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, requireToken("secret", rpc.DefaultServer))
+	address := l.Addr().String()
+
+	for _, token := range []string{"", "wrong"} {
+		_, err := dialHTTP("tcp", address, rpc.DefaultRPCPath, token, nil)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "401 Unauthorized")
+	}
+
+	client, err := dialHTTP("tcp", address, rpc.DefaultRPCPath, "secret", nil)
+	assert.NoError(t, err)
+	var ct int
+	ctx := "ctx1"
+	assert.NoError(t, client.Call("*cmd.DefaultBuilder.Status", &ctx, &ct))
+	assert.Equal(t, 29, ct)
+}
@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"github.com/c-bata/go-prompt"
 	"io"
+	"k8s.io/apimachinery/pkg/util/duration"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"net"
 	"net/http"
 	"net/rpc"
 	"os"
 	"os/exec"
+	"path"
 	"reflect"
 	"sort"
 	"strings"
@@ -29,10 +32,10 @@ type Builder interface {
 	PodCompleter(in prompt.Document) []prompt.Suggest
 	PopulateSuggestions(resources *[]model.KubeResource)
 	PopulateContextSuggestions(source map[string][][]string)
-	KubeClient(clients map[string]kubernetes.Interface) service.KubeClient
+	KubeClient(clients map[string]kubernetes.Interface, dynamicClients map[string]dynamic.Interface) service.KubeClient
 	WatchCache() *WatchCache
-	WatchClient(address, logLvlArg, kubeConfigArg, kubeCtxArg string) (WatchClient, error)
-	Serve(l net.Listener, c *WatchCache) error
+	WatchClient(address, logLvlArg, kubeConfigArg, kubeCtxArg string, tf TLSFiles) (WatchClient, error)
+	Serve(l net.Listener, c *WatchCache, token string) error
 	SetCmdOptions(cmdoptions cmdOptions)
 }
 
@@ -76,13 +79,72 @@ func (b *DefaultBuilder) PopulateSuggestions(resources *[]model.KubeResource) {
 		}
 		s = append(s, prompt.Suggest{
 			Text:        text,
-			Description: res.Status,
+			Description: describe(res, time.Now()),
 		})
 	}
 
 	b.suggestions = s
 }
 
+// What's shown next to a resource at the prompt: its status and, for a pod, what tells it apart from the pods named like
+// it, down to its owner and images, or, for a node, its roles, version and anything it's short of
+func describe(res model.KubeResource, now time.Time) string {
+	if res.Node != nil {
+		return describeNode(res)
+	}
+	if res.Pod == nil {
+		return res.Status
+	}
+
+	parts := []string{res.Status}
+	if res.Pod.Containers > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d ready", res.Pod.Ready, res.Pod.Containers))
+	}
+	if res.Pod.Restarts > 0 {
+		parts = append(parts, fmt.Sprintf("%d restarts", res.Pod.Restarts))
+	}
+	if !res.CreatedAt.IsZero() {
+		parts = append(parts, duration.HumanDuration(now.Sub(res.CreatedAt)))
+	}
+	if res.Pod.Node != "" {
+		parts = append(parts, res.Pod.Node)
+	}
+	if res.Pod.IP != "" {
+		parts = append(parts, res.Pod.IP)
+	}
+	if res.Pod.Owner != nil {
+		parts = append(parts, strings.ToLower(res.Pod.Owner.Kind)+"/"+res.Pod.Owner.Name)
+	}
+	if len(res.Pod.Images) > 0 {
+		images := make([]string, 0, len(res.Pod.Images))
+		for _, image := range res.Pod.Images {
+			// the registry and repository path are much the same for all of a pod's images
+			images = append(images, path.Base(image))
+		}
+		parts = append(parts, strings.Join(images, ","))
+	}
+
+	return strings.Join(parts, " | ")
+}
+
+func describeNode(res model.KubeResource) string {
+	parts := []string{res.Status}
+	if len(res.Node.Roles) > 0 {
+		parts = append(parts, strings.Join(res.Node.Roles, ","))
+	}
+	if res.Node.KubeletVersion != "" {
+		parts = append(parts, res.Node.KubeletVersion)
+	}
+	if len(res.Node.Pressure) > 0 {
+		parts = append(parts, strings.Join(res.Node.Pressure, ","))
+	}
+	if len(res.Node.Taints) > 0 {
+		parts = append(parts, strings.Join(res.Node.Taints, ","))
+	}
+
+	return strings.Join(parts, " | ")
+}
+
 func (b *DefaultBuilder) PopulateContextSuggestions(source map[string][][]string) {
 	target := make(map[string][]prompt.Suggest)
 	for k, v := range source {
@@ -122,8 +184,8 @@ func (b *DefaultBuilder) PodCompleter(in prompt.Document) []prompt.Suggest {
 	return prompt.FilterContains(b.suggestions, in.GetWordBeforeCursor(), true)
 }
 
-func (b *DefaultBuilder) KubeClient(clients map[string]kubernetes.Interface) service.KubeClient {
-	return service.NewKubeClient(clients)
+func (b *DefaultBuilder) KubeClient(clients map[string]kubernetes.Interface, dynamicClients map[string]dynamic.Interface) service.KubeClient {
+	return service.NewKubeClient(clients, dynamicClients)
 }
 
 func (b *DefaultBuilder) WatchCache() *WatchCache {
@@ -134,34 +196,49 @@ func (b *DefaultBuilder) WatchCache() *WatchCache {
 Connect to the Watch server - if its not running then start it and wait for it
 to cache resource entries from the Kube clusters
 */
-func (b *DefaultBuilder) WatchClient(address, logLvlArg, kubeConfigArg, kubeCtxArg string) (WatchClient, error) {
+func (b *DefaultBuilder) WatchClient(address, logLvlArg, kubeConfigArg, kubeCtxArg string, tf TLSFiles) (WatchClient, error) {
 	//Declaring these explicitly because of the exponential backoff function later on
 	var (
 		dwc *WatchClientDefault
 		err error
 	)
 
-	dwc, err = NewWatchClient(address, reflect.TypeOf(b).String(), "")
+	dwc, err = NewWatchClient(address, reflect.TypeOf(b).String(), "", tf)
 	// creating the client was successful, meaning the Watch server is already running
 	// so just return it
 	if err == nil {
-		_, err := dwc.Status(kubeCtxArg)
-		if err != nil {
+		if _, err := dwc.Status(kubeCtxArg); err == nil {
+			return dwc, nil
+		}
+
+		// the server isn't watching the context yet so attach it, rather than having to restart the server
+		log.Debugf("adding context %s to the running Watch server", kubeCtxArg)
+		if err := dwc.AddContext(kubeCtxArg); err != nil {
 			return nil, err
 		}
+		boff := backoff.NewExponentialBackOff()
+		boff.MaxElapsedTime = 10 * time.Second //max time to wait for the Watch server to start serving the context's resources
+		err = backoff.Retry(func() error {
+			_, err := dwc.Status(kubeCtxArg)
+			return err
+		}, boff)
 
-		return dwc, nil
+		return dwc, err
 	}
 
-	// a connection refused error means the Watch server isn't running - any other
+	// a connection refused (or missing socket) error means the Watch server isn't running - any other
 	// error means a different problem to return the error
-	if !strings.Contains(err.Error(), "connection refused") {
+	if !isServerDown(err) {
 		return nil, err
 	}
+	// a server on TLS is shared and run elsewhere, there's no local server to launch
+	if tf.enabled() {
+		return nil, fmt.Errorf("the watch server at %s isn't running", address)
+	}
 
 	// launch the Watch cmd in a separate process
 	log.Debugf("launching Watch server for context %s", kubeCtxArg)
-	if err = launchWatchCmd(logLvlArg, kubeConfigArg, kubeCtxArg); err != nil {
+	if err = launchWatchCmd(address, logLvlArg, kubeConfigArg, kubeCtxArg, tf.Token); err != nil {
 		log.Errorf("Failed to launch Watch server: %s", err)
 		return nil, err
 	}
@@ -175,7 +252,7 @@ func (b *DefaultBuilder) WatchClient(address, logLvlArg, kubeConfigArg, kubeCtxA
 	boff := backoff.NewExponentialBackOff()
 	boff.MaxElapsedTime = 10 * time.Second //max time to wait for the Watch server to start serving Kube resources
 	err = backoff.Retry(func() error {
-		dwc, err = NewWatchClient(address, reflect.TypeOf(b).String(), "")
+		dwc, err = NewWatchClient(address, reflect.TypeOf(b).String(), "", tf)
 		if err != nil {
 			return err
 		}
@@ -187,10 +264,10 @@ func (b *DefaultBuilder) WatchClient(address, logLvlArg, kubeConfigArg, kubeCtxA
 
 }
 
-func (b *DefaultBuilder) Serve(l net.Listener, cache *WatchCache) error {
+func (b *DefaultBuilder) Serve(l net.Listener, cache *WatchCache, token string) error {
 	rpc.RegisterName(reflect.TypeOf(b).String(), cache)
 	rpc.HandleHTTP()
-	return http.Serve(l, nil)
+	return http.Serve(l, requireToken(token, http.DefaultServeMux))
 }
 
 func (b *DefaultBuilder) isNameSelected(text string) bool {
@@ -215,68 +292,39 @@ func isAlreadyText(text string) bool {
 	return false
 }
 
-func getCommonGetOptions() []prompt.Suggest {
-	options := []prompt.Suggest{
-		{Text: "--output json", Description: "Output manifest in json format"},
-		{Text: "--output yaml", Description: "Output manifest in yaml format"},
-		{Text: "--output wide", Description: "Output more details"},
-		{Text: "--watch", Description: "After listing/getting the requested object, watch for changes"},
-		{Text: "@describe", Description: "Use kubectl describe instead of get on the resource"},
-	}
-
-	return options
-}
-
-func getPodGetOptions() []prompt.Suggest {
-	options := getCommonGetOptions()
-
-	return options
-}
-
-func getNodeGetOptions() []prompt.Suggest {
-	return getCommonGetOptions()
+func getDefaultOptions() []prompt.Suggest {
+	return []prompt.Suggest{}
 }
 
-func getLogOptions() []prompt.Suggest {
-	options := []prompt.Suggest{
-		{Text: "--all-containers", Description: "Get all containers' logs in the pod"},
-		{Text: "--container", Description: "Get logs for specific container"},
-		{Text: "--follow", Description: "Specify if the logs should be streamed"},
-		{Text: "--prefix", Description: "Prefix each log line with the log source (pod name and container name)"},
-		{Text: "--previous", Description: "Print the logs for the previous instance of the container in a pod if it exists"},
-		{Text: "--timestamps", Description: "Include timestamps on each line in the log output"},
+func launchWatchCmd(bind, logLvlArg, kubeConfigArg, kubeCtxArg, tokenFile string) error {
+	args := []string{"--syslog"}
+	if strUtil.IsNotBlank(logLvlArg) {
+		args = append(args, logLvlArg)
 	}
-
-	return options
-}
-
-func getSSHOptions() []prompt.Suggest {
-	options := []prompt.Suggest{
-		{Text: "--container", Description: "Get logs for specific container"},
+	// the server has to listen where this client is going to look for it, and shouldn't outlive its use
+	args = append(args, bindArgs(bind)...)
+	args = append(args, "--idle-timeout", launchedIdleTimeout.String())
+	if strUtil.IsNotBlank(tokenFile) {
+		args = append(args, "--token-file", tokenFile)
 	}
+	// without --kubeconfig the server loads kubeconfig from the $KUBECONFIG it inherits, like this client
+	if strUtil.IsNotBlank(kubeConfigArg) {
+		args = append(args, "--kubeconfig", kubeConfigArg)
+	}
+	args = append(args, kubeCtxArg)
 
-	return options
-}
-
-func getDefaultOptions() []prompt.Suggest {
-	return []prompt.Suggest{}
+	return startWatchServer(args)
 }
 
-func launchWatchCmd(logLvlArg, kubeConfigArg, kubeCtxArg string) error {
+// Start 'kubectl-ac watch' with the arguments in its own process group, so it outlives the command starting it
+func startWatchServer(args []string) error {
 	// find the absolute path to the running executable and use this for executing the watch cmd
 	exe, err := os.Executable()
 	if err != nil {
 		return fmt.Errorf("failed to find execuable to launch: %s", err)
 	}
 	log.Debugf("path to watch executable: %s", exe)
-	cmd := exec.Command(
-		exe,
-		"watch",
-		"--syslog",
-		logLvlArg,
-		"--kubeconfig",
-		kubeConfigArg,
-		kubeCtxArg)
+	cmd := exec.Command(exe, append([]string{"watch"}, args...)...)
 	var sysproc = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
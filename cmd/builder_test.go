@@ -5,6 +5,7 @@ import (
 	"fmt"
 	v1 "k8s.io/api/core/v1"
 	"testing"
+	"time"
 
 	"github.com/c-bata/go-prompt"
 	"github.com/stretchr/testify/assert"
@@ -42,3 +43,50 @@ func TestPodCompleter(t *testing.T) {
 	actual := b.PodCompleter(in)
 	assert.Equal(t, expected, actual)
 }
+
+func TestDescribe(t *testing.T) {
+	now := time.Now()
+	pod := model.KubeResource{
+		TypeMeta: model.TypeMeta{Kind: "pod"},
+		ResourceMeta: model.ResourceMeta{
+			Name:      "checkout-5d4f8-abcde",
+			Status:    string(v1.PodRunning),
+			CreatedAt: now.Add(-3 * time.Hour),
+			Pod: &model.PodMeta{
+				Owner:      &model.OwnerRef{Kind: "Deployment", Name: "checkout"},
+				Node:       "node1",
+				IP:         "10.0.0.7",
+				Ready:      1,
+				Containers: 2,
+				Restarts:   2,
+				Images:     []string{"busybox", "registry.example.com/shop/checkout:1.2"},
+			},
+		},
+	}
+	assert.Equal(t, "Running | 1/2 ready | 2 restarts | 3h | node1 | 10.0.0.7 | deployment/checkout | busybox,checkout:1.2", describe(pod, now))
+
+	pod.Pod = &model.PodMeta{}
+	pod.CreatedAt = time.Time{}
+	assert.Equal(t, "Running", describe(pod, now))
+
+	node := model.KubeResource{
+		TypeMeta: model.TypeMeta{Kind: "node"},
+		ResourceMeta: model.ResourceMeta{
+			Name:   "node1",
+			Status: "Ready,SchedulingDisabled",
+			Node: &model.NodeMeta{
+				Roles:          []string{"worker"},
+				KubeletVersion: "v1.19.2",
+				Pressure:       []string{"MemoryPressure", "DiskPressure"},
+				Taints:         []string{"dedicated=gpu:NoSchedule"},
+			},
+		},
+	}
+	assert.Equal(t, "Ready,SchedulingDisabled | worker | v1.19.2 | MemoryPressure,DiskPressure | dedicated=gpu:NoSchedule", describe(node, now))
+
+	node.Node = &model.NodeMeta{}
+	assert.Equal(t, "Ready,SchedulingDisabled", describe(node, now))
+
+	svc := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "service"}, ResourceMeta: model.ResourceMeta{Status: "ClusterIP"}}
+	assert.Equal(t, "ClusterIP", describe(svc, now))
+}
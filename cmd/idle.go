@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// how long a watch server started by a client keeps running without being queried
+const launchedIdleTimeout = time.Hour
+
+// Record that the contexts have just been queried
+func (c *WatchCache) touch(contexts ...string) {
+	c.queriedMu.Lock()
+	defer c.queriedMu.Unlock()
+
+	now := time.Now()
+	c.lastQuery = now
+	for _, s := range contexts {
+		c.lastQueried[s] = now
+	}
+}
+
+// When any context was last queried, or when the cache was created if none has been
+func (c *WatchCache) lastQueryTime() time.Time {
+	c.queriedMu.Lock()
+	defer c.queriedMu.Unlock()
+
+	return c.lastQuery
+}
+
+// When the context was last queried, zero if it hasn't been
+func (c *WatchCache) lastQueriedTime(s string) time.Time {
+	c.queriedMu.Lock()
+	defer c.queriedMu.Unlock()
+
+	return c.lastQueried[s]
+}
+
+// Those of the contexts that haven't been queried for at least the timeout
+func (c *WatchCache) idleContexts(contexts []string, timeout time.Duration, now time.Time) []string {
+	c.queriedMu.Lock()
+	defer c.queriedMu.Unlock()
+
+	idle := []string{}
+	for _, s := range contexts {
+		if now.Sub(c.lastQueried[s]) >= timeout {
+			idle = append(idle, s)
+		}
+	}
+
+	return idle
+}
+
+// Check often enough that nothing runs much longer than the timeout, without waking up more than once a minute
+func idleCheckInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 10
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	return interval
+}
+
+/*
+Stop watching contexts that haven't been queried for the timeout and shut the server down once nothing at all has
+been queried for that long. A client querying a context that was dropped adds it again, like any other context the
+server doesn't watch
+*/
+func loopIdle(ctx context.Context, w *watcher, timeout time.Duration, shutdown func()) {
+	check := func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(idleCheckInterval(timeout)):
+			}
+
+			now := time.Now()
+			for _, s := range w.c.idleContexts(w.contextNames(), timeout, now) {
+				l := log.WithField("context", s)
+				l.WithField("timeout", timeout).Info("context hasn't been queried, stopping watching it")
+				if err := w.removeContext(s); err != nil {
+					l.WithField("error", err).Error("failed to stop watching idle context")
+				}
+			}
+			if now.Sub(w.c.lastQueryTime()) >= timeout {
+				log.WithField("timeout", timeout).Info("nothing has been queried, shutting down")
+				shutdown()
+				return
+			}
+		}
+	}
+
+	go check()
+}
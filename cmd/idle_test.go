@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleContexts(t *testing.T) {
+	c := NewWatchCache()
+	c.touch("prod")
+	now := time.Now()
+
+	assert.Equal(t, []string{"dev"}, c.idleContexts([]string{"dev", "prod"}, time.Minute, now))
+	assert.Equal(t, []string{"dev", "prod"}, c.idleContexts([]string{"dev", "prod"}, time.Minute, now.Add(2*time.Minute)))
+
+	c.removeContext("prod")
+	assert.True(t, c.lastQueriedTime("prod").IsZero())
+	assert.False(t, c.lastQueryTime().IsZero())
+}
+
+func TestIdleCheckInterval(t *testing.T) {
+	assert.Equal(t, 10*time.Millisecond, idleCheckInterval(100*time.Millisecond))
+	assert.Equal(t, time.Minute, idleCheckInterval(time.Hour))
+}
+
+func TestIdleTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+
+	b := NewTestBuilder()
+	cmd := NewWatchCommand(b)
+	cmd.Flags().Set("kubeconfig", "test_data/kubeconfig_valid")
+	cmd.Flags().Set("socket", filepath.Join(dir, "watch.sock"))
+	cmd.Flags().Set("snapshot-interval", "0")
+	cmd.Flags().Set("idle-timeout", "200ms")
+
+	done := make(chan error)
+	go func() {
+		done <- cmd.RunE(cmd, []string{"prod", "dev"})
+	}()
+
+	bind, err := GetBind(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var client WatchClient
+	for i := 0; i < 100 && client == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if client, err = b.WatchClient(bind, "", "", "", TLSFiles{}); err != nil {
+			client = nil
+		}
+	}
+	if client == nil {
+		t.Fatalf("could not connect to the watch server: %s", err)
+	}
+
+	// keep querying prod for longer than the timeout, dev is dropped but the server keeps running
+	for i := 0; i < 20; i++ {
+		client.Status("prod")
+		time.Sleep(20 * time.Millisecond)
+	}
+	contexts, err := client.ListContexts()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"prod"}, contexts)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle server didn't shut down")
+	}
+}
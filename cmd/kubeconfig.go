@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"autocli/service"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// how often the kubeconfig files are checked for changes
+const kubeConfigCheckInterval = 5 * time.Second
+
+// The parts of kubeconfig the clients for a context are built from
+type contextDefinition struct {
+	Context  *api.Context
+	Cluster  *api.Cluster
+	AuthInfo *api.AuthInfo
+}
+
+/*
+The rules kubectl loads kubeconfig with: the file given in --kubeconfig if there is one, or else the files listed
+in $KUBECONFIG merged together, or else ~/.kube/config. A list of files, like the one a client's context is
+qualified with, is merged together the same way as $KUBECONFIG
+*/
+func loadingRules(kubeConfigFile string) *clientcmd.ClientConfigLoadingRules {
+	if files := filepath.SplitList(kubeConfigFile); len(files) > 1 {
+		return &clientcmd.ClientConfigLoadingRules{Precedence: files}
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeConfigFile
+
+	return rules
+}
+
+/*
+A context from kubeconfig files the watch server doesn't load itself is known to the server by its name qualified
+with the files the client loads, e.g. dev@/home/me/.kube/team-b.yaml:/home/me/.kube/credentials.yaml, so that it
+isn't mistaken for the server's own context of the same name and its cluster and user are found in whichever of
+the files defines them. Contexts are only qualified with absolute paths, which tells them apart from names such as
+kubernetes-admin@kubernetes
+*/
+func qualifiedContext(name string, files []string) string {
+	return name + "@" + strings.Join(files, string(filepath.ListSeparator))
+}
+
+// The name of the context and the kubeconfig files it's loaded from, none for one of the server's own contexts
+func splitContext(key string) (string, []string) {
+	i := strings.LastIndex(key, "@")
+	if i <= 0 {
+		return key, nil
+	}
+	files := filepath.SplitList(key[i+1:])
+	for _, f := range files {
+		if !filepath.IsAbs(f) {
+			return key, nil
+		}
+	}
+
+	return key[:i], files
+}
+
+// The absolute path of the file a context is defined in, blank if the context can't be found
+func contextOrigin(rules *clientcmd.ClientConfigLoadingRules, name string) string {
+	config, err := rules.Load()
+	if err != nil {
+		return ""
+	}
+	c, ok := config.Contexts[name]
+	if !ok || c.LocationOfOrigin == "" {
+		return ""
+	}
+	origin, err := filepath.Abs(c.LocationOfOrigin)
+	if err != nil {
+		return ""
+	}
+
+	return origin
+}
+
+// Load kubeconfig and describe each context by its definition, so a change to the context, its cluster or its
+// user (e.g. a rotated token) can be spotted by comparing the descriptions
+func contextDefinitions(kubeConfigFile string) (map[string]string, error) {
+	config, err := loadingRules(kubeConfigFile).Load()
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := make(map[string]string)
+	for name, ctx := range config.Contexts {
+		data, err := json.Marshal(contextDefinition{
+			Context:  ctx,
+			Cluster:  config.Clusters[ctx.Cluster],
+			AuthInfo: config.AuthInfos[ctx.AuthInfo],
+		})
+		if err != nil {
+			return nil, err
+		}
+		definitions[name] = string(data)
+	}
+
+	return definitions, nil
+}
+
+// the name of the extension of a context in kubeconfig that holds kubectl-ac's settings for the context
+const kubeConfigExtension = "kubectl-ac"
+
+// kubectl-ac's settings for a context, e.g.
+//
+//	extensions:
+//	- name: kubectl-ac
+//	  extension:
+//	    namespaces: [team-a, team-b]
+type contextExtension struct {
+	// the namespaces to watch namespaced kinds in, instead of across the cluster
+	Namespaces []string `json:"namespaces"`
+}
+
+/*
+The namespaces of a context to watch namespaced kinds in: those given in --namespaces for the context or for every
+context, or failing that those in the context's extension in kubeconfig. If there are none they're watched across
+the cluster, falling back to the context's namespace (or "default") if that's forbidden
+*/
+func contextNamespaces(kubeConfigFile, ctx string, flagged map[string][]string) (service.Namespaces, error) {
+	config, err := loadingRules(kubeConfigFile).Load()
+	if err != nil {
+		return service.Namespaces{}, err
+	}
+	c, ok := config.Contexts[ctx]
+	if !ok {
+		return service.Namespaces{}, fmt.Errorf("context %s not found in kubeconfig", ctx)
+	}
+
+	namespaces := service.Namespaces{Fallback: c.Namespace}
+	if namespaces.Fallback == "" {
+		namespaces.Fallback = "default"
+	}
+	if ns, ok := flagged[ctx]; ok {
+		namespaces.Watch = ns
+	} else if ns, ok := flagged[""]; ok {
+		namespaces.Watch = ns
+	} else if ext, ok := c.Extensions[kubeConfigExtension].(*runtime.Unknown); ok {
+		var ce contextExtension
+		if err := json.Unmarshal(ext.Raw, &ce); err != nil {
+			return service.Namespaces{}, fmt.Errorf("invalid %s extension of context %s: %s", kubeConfigExtension, ctx, err)
+		}
+		namespaces.Watch = ce.Namespaces
+	}
+
+	return namespaces, nil
+}
+
+// Parse the values of --namespaces, each a comma-separated list of namespaces optionally preceded by the context
+// it's for, e.g. dev=team-a,team-b. A list without a context is for every context not given one of its own
+func parseNamespaces(values []string) (map[string][]string, error) {
+	namespaces := make(map[string][]string)
+	for _, v := range values {
+		ctx, list := "", v
+		if i := strings.Index(v, "="); i >= 0 {
+			ctx, list = strings.TrimSpace(v[:i]), v[i+1:]
+		}
+		for _, ns := range strings.Split(list, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				namespaces[ctx] = append(namespaces[ctx], ns)
+			}
+		}
+		if len(namespaces[ctx]) == 0 {
+			return nil, fmt.Errorf("no namespaces given in %q", v)
+		}
+	}
+
+	return namespaces, nil
+}
+
+// The kubeconfig files loaded, in the order they take precedence
+func kubeConfigFiles(kubeConfigFile string) []string {
+	rules := loadingRules(kubeConfigFile)
+	if rules.ExplicitPath != "" {
+		return []string{rules.ExplicitPath}
+	}
+	files := []string{}
+	for _, f := range rules.Precedence {
+		if f != "" && !Contains(files, f) {
+			files = append(files, f)
+		}
+	}
+
+	return files
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Record when each file was last modified and how big it is; a file that doesn't exist has a zero state
+func statFiles(files []string) map[string]fileState {
+	states := make(map[string]fileState)
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			states[f] = fileState{modTime: info.ModTime(), size: info.Size()}
+		} else {
+			states[f] = fileState{}
+		}
+	}
+
+	return states
+}
+
+// Reload kubeconfig whenever one of the files the watched contexts are loaded from changes
+func loopKubeConfig(ctx context.Context, w *watcher, interval time.Duration) {
+	check := func() {
+		last := statFiles(w.kubeConfigFiles())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			files := w.kubeConfigFiles()
+			current := statFiles(files)
+			for _, f := range files {
+				if current[f] != last[f] {
+					log.WithField("path", f).Info("kubeconfig has changed, reloading")
+					w.reloadKubeConfig()
+					break
+				}
+			}
+			last = current
+		}
+	}
+
+	go check()
+}
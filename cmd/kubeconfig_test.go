@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Copy the test kubeconfig, and the certificates it refers to, into a directory it can be changed in
+func copyKubeConfig(t *testing.T, dir string) string {
+	for _, f := range []string{"kubeconfig_valid", "ca.pem", "cert.pem", "key.pem"} {
+		data, err := ioutil.ReadFile(filepath.Join("test_data", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, f), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return filepath.Join(dir, "kubeconfig_valid")
+}
+
+func TestReloadKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := copyKubeConfig(t, dir)
+
+	b := NewTestBuilder()
+	c := b.WatchCache()
+	w := &watcher{
+		c:              c,
+		kc:             b.KubeClient(map[string]kubernetes.Interface{}, map[string]dynamic.Interface{}),
+		kubeConfigFile: path,
+		only:           "pod",
+		contexts:       make(map[string]*watchedContext),
+		mu:             &sync.Mutex{},
+	}
+	assert.NoError(t, w.addContext("dev"))
+	assert.NoError(t, w.addContext("prod"))
+	for len(c.objects("dev")) == 0 || len(c.objects("prod")) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	dev, prod := w.contexts["dev"], w.contexts["prod"]
+
+	// nothing changed
+	w.reloadKubeConfig()
+	assert.Same(t, dev, w.contexts["dev"])
+	assert.Same(t, prod, w.contexts["prod"])
+
+	// dev's cluster moved
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(strings.Replace(string(data), "https://bar.com", "https://baz.com", 1)), 0600))
+	w.reloadKubeConfig()
+
+	assert.False(t, dev == w.contexts["dev"])
+	assert.Contains(t, w.contexts["dev"].definition, "https://baz.com")
+	assert.Same(t, prod, w.contexts["prod"])
+	assert.NotEmpty(t, c.objects("dev"))
+	assert.NotEmpty(t, c.objects("prod"))
+}
+
+func TestKubeConfigFiles(t *testing.T) {
+	defer os.Setenv("KUBECONFIG", os.Getenv("KUBECONFIG"))
+	os.Setenv("KUBECONFIG", strings.Join([]string{"/a/config", "/b/config", "/a/config"}, string(filepath.ListSeparator)))
+
+	assert.Equal(t, []string{"/a/config", "/b/config"}, kubeConfigFiles(""))
+	// like kubectl's --kubeconfig, a file given in --kubeconfig is the only one loaded
+	assert.Equal(t, []string{"/c/config"}, kubeConfigFiles("/c/config"))
+}
+
+func TestParseNamespaces(t *testing.T) {
+	namespaces, err := parseNamespaces([]string{"dev=red, green", "blue"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"dev": {"red", "green"}, "": {"blue"}}, namespaces)
+
+	_, err = parseNamespaces([]string{"dev="})
+	assert.Error(t, err)
+}
+
+func TestContextNamespaces(t *testing.T) {
+	kubeConfig := "test_data/kubeconfig_namespaces"
+
+	// from the extension in kubeconfig, falling back to the context's namespace
+	namespaces, err := contextNamespaces(kubeConfig, "dev", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"red", "green"}, namespaces.Watch)
+	assert.Equal(t, "red", namespaces.Fallback)
+
+	// across the cluster, falling back to the default namespace
+	namespaces, err = contextNamespaces(kubeConfig, "prod", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, namespaces.Watch)
+	assert.Equal(t, "default", namespaces.Fallback)
+
+	// --namespaces takes precedence, a list for the context over one for every context
+	flagged := map[string][]string{"dev": {"blue"}, "": {"yellow"}}
+	namespaces, _ = contextNamespaces(kubeConfig, "dev", flagged)
+	assert.Equal(t, []string{"blue"}, namespaces.Watch)
+	namespaces, _ = contextNamespaces(kubeConfig, "prod", flagged)
+	assert.Equal(t, []string{"yellow"}, namespaces.Watch)
+
+	_, err = contextNamespaces(kubeConfig, "unknown", nil)
+	assert.Error(t, err)
+}
+
+// Write a kubeconfig file with a context of each name, each on a cluster of its own
+func writeKubeConfig(t *testing.T, path, server string, contexts ...string) {
+	config := "clusters:\n"
+	for _, ctx := range contexts {
+		config += "- name: " + ctx + "\n  cluster:\n    server: " + server + "\n    insecure-skip-tls-verify: true\n"
+	}
+	config += "contexts:\n"
+	for _, ctx := range contexts {
+		config += "- name: " + ctx + "\n  context:\n    cluster: " + ctx + "\n    user: me\n"
+	}
+	config += "users:\n- name: me\n  user:\n    token: secret\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergedKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	teamA, teamB := filepath.Join(dir, "team-a"), filepath.Join(dir, "team-b")
+	writeKubeConfig(t, teamA, "https://a.com", "dev", "staging")
+	writeKubeConfig(t, teamB, "https://b.com", "dev", "prod")
+	defer os.Setenv("KUBECONFIG", os.Getenv("KUBECONFIG"))
+	os.Setenv("KUBECONFIG", teamA+string(filepath.ListSeparator)+teamB)
+
+	b := NewTestBuilder()
+	w := &watcher{
+		c:                 b.WatchCache(),
+		kc:                b.KubeClient(map[string]kubernetes.Interface{}, map[string]dynamic.Interface{}),
+		clientKubeConfigs: true,
+		only:              "pod",
+		contexts:          make(map[string]*watchedContext),
+		mu:                &sync.Mutex{},
+	}
+
+	// the files in $KUBECONFIG are merged, the first to define a context wins
+	assert.NoError(t, w.addContext("dev"))
+	assert.NoError(t, w.addContext("prod"))
+	assert.Contains(t, w.contexts["dev"].definition, "https://a.com")
+	assert.Contains(t, w.contexts["prod"].definition, "https://b.com")
+	assert.Equal(t, []string{teamA, teamB}, w.kubeConfigFiles())
+
+	// a client loading other files knows the server's contexts by their names as long as they're from the same file
+	assert.Equal(t, "dev", w.contextFor("dev", []string{teamA}))
+	assert.Equal(t, "prod", w.contextFor("prod", []string{teamB}))
+	assert.Equal(t, "dev@"+teamB, w.contextFor("dev", []string{teamB}))
+	// files the server can't read are taken to be its own
+	assert.Equal(t, "dev", w.contextFor("dev", []string{filepath.Join(dir, "missing")}))
+
+	// so the two devs are cached apart
+	assert.NoError(t, w.addContext("dev@"+teamB))
+	assert.Contains(t, w.contexts["dev@"+teamB].definition, "https://b.com")
+	assert.Contains(t, w.contexts["dev"].definition, "https://a.com")
+	assert.Error(t, w.addContext("staging@"+teamB))
+
+	// a client's context is loaded from all of its files, which may define its user in another one
+	teamC, credentials := filepath.Join(dir, "team-c"), filepath.Join(dir, "credentials")
+	config := "clusters:\n- name: c\n  cluster:\n    server: https://c.com\n    insecure-skip-tls-verify: true\n"
+	config += "contexts:\n- name: dev\n  context:\n    cluster: c\n    user: shared\n"
+	if err := ioutil.WriteFile(teamC, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(credentials, []byte("users:\n- name: shared\n  user:\n    token: shared-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := w.contextFor("dev", []string{teamC, credentials})
+	assert.Equal(t, "dev@"+teamC+string(filepath.ListSeparator)+credentials, ctx)
+	if assert.NoError(t, w.addContext(ctx)) {
+		assert.Contains(t, w.contexts[ctx].definition, "https://c.com")
+		assert.Contains(t, w.contexts[ctx].definition, "shared-secret")
+	}
+	assert.Contains(t, w.kubeConfigFiles(), credentials)
+
+	// a server shared with other users only watches its own kubeconfig's contexts
+	w.clientKubeConfigs = false
+	assert.Equal(t, "dev", w.contextFor("dev", []string{teamB}))
+	assert.Error(t, w.addContext("prod@"+teamB))
+
+	w.stopAll()
+}
+
+func TestSplitContext(t *testing.T) {
+	name, files := splitContext("dev@/home/me/.kube/team-b")
+	assert.Equal(t, "dev", name)
+	assert.Equal(t, []string{"/home/me/.kube/team-b"}, files)
+	name, files = splitContext(qualifiedContext("dev", []string{"/home/me/.kube/team-b", "/home/me/.kube/credentials"}))
+	assert.Equal(t, "dev", name)
+	assert.Equal(t, []string{"/home/me/.kube/team-b", "/home/me/.kube/credentials"}, files)
+
+	// context names can have an @ in them
+	name, files = splitContext("kubernetes-admin@kubernetes")
+	assert.Equal(t, "kubernetes-admin@kubernetes", name)
+	assert.Nil(t, files)
+	name, files = splitContext(qualifiedContext("kubernetes-admin@kubernetes", []string{"/etc/kubernetes/admin.conf"}))
+	assert.Equal(t, "kubernetes-admin@kubernetes", name)
+	assert.Equal(t, []string{"/etc/kubernetes/admin.conf"}, files)
+}
+
+func TestAcceptsClientKubeConfigs(t *testing.T) {
+	assert.True(t, acceptsClientKubeConfigs(unixPrefix+"/run/user/1000/kubectl-ac/watch.sock", TLSFiles{}))
+	assert.True(t, acceptsClientKubeConfigs("127.0.0.1:33033", TLSFiles{}))
+	assert.False(t, acceptsClientKubeConfigs("127.0.0.1:33033", TLSFiles{CA: "ca.pem"}))
+	assert.False(t, acceptsClientKubeConfigs("0.0.0.0:33033", TLSFiles{Cert: "server.pem", Key: "server-key.pem"}))
+	assert.False(t, acceptsClientKubeConfigs("10.1.2.3:33033", TLSFiles{}))
+}
+
+func TestRemoteClientKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a file on the server's host a remote client knows the path of
+	other := filepath.Join(dir, "other")
+	writeKubeConfig(t, other, "https://other.com", "dev")
+
+	b := NewTestBuilder()
+	w := &watcher{
+		c:                 b.WatchCache(),
+		kc:                b.KubeClient(map[string]kubernetes.Interface{}, map[string]dynamic.Interface{}),
+		kubeConfigFile:    "test_data/kubeconfig_valid",
+		clientKubeConfigs: acceptsClientKubeConfigs("0.0.0.0:33033", TLSFiles{Cert: "server.pem", Key: "server-key.pem"}),
+		only:              "pod",
+		contexts:          make(map[string]*watchedContext),
+		mu:                &sync.Mutex{},
+	}
+	c := w.c
+	c.watcher = w
+
+	// neither resolving nor adding a context makes the server load the file
+	var ctx string
+	assert.NoError(t, c.ResolveContext(&ContextRef{Name: "dev", Files: []string{other}}, &ctx))
+	assert.Equal(t, "dev", ctx)
+	qualified := qualifiedContext("dev", []string{other})
+	var contexts []string
+	err = c.AddContext(&qualified, &contexts)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "doesn't load")
+	}
+	assert.Empty(t, w.contextNames())
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// The names of the namespaces the watch server has cached for the context, empty if it hasn't got any - it may not
+// be watching namespaces or be allowed to list them
+func namespaceNames(client WatchClient, context string) ([]string, error) {
+	kr, err := client.Resources(WatchFilter{Context: context, Kind: "namespace"})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(kr))
+	for _, r := range kr {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Check the namespace given with -n is one of the context's, so that a typo is reported rather than silently
+// finding nothing. Without any cached namespaces to check against any namespace is taken as it is
+func checkNamespace(client WatchClient, context, ns string) error {
+	if ns == "" {
+		return nil
+	}
+	names, err := namespaceNames(client, context)
+	if err != nil {
+		return err
+	}
+
+	return namespaceExists(context, ns, names)
+}
+
+func namespaceExists(context, ns string, names []string) error {
+	if len(names) == 0 || Contains(names, strings.ToLower(ns)) {
+		return nil
+	}
+	if s := closest(strings.ToLower(ns), names); s != "" {
+		return fmt.Errorf("namespace %q not found in context %s, did you mean %q?", ns, context, s)
+	}
+
+	return fmt.Errorf("namespace %q not found in context %s", ns, context)
+}
+
+// The name most like s, if any is close enough to be what was meant: a few characters off, or one starting with s
+func closest(s string, names []string) string {
+	// up to one edit for every three characters
+	best, bestDistance := "", len(s)/3+2
+	for _, name := range names {
+		if d := editDistance(s, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, s) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// The Levenshtein distance between a and b, counting a swap of adjacent characters as a single edit
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// Complete -n with the namespaces of the context the resources command is for, from a watch server that's
+// already running - completing shouldn't have to wait for one to start
+func namespaceCompletion(b Builder) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		names, err := runningServerNamespaces(b, cmd, args)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		var matches []string
+		for _, name := range names {
+			if strings.HasPrefix(name, toComplete) {
+				matches = append(matches, name)
+			}
+		}
+
+		return matches, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+func runningServerNamespaces(b Builder, cmd *cobra.Command, args []string) ([]string, error) {
+	if err := RunCommon(cmd); err != nil {
+		return nil, err
+	}
+	kubeConfigFile, kubeConfig, err := loadKubeConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	context, err := contextFromArgs(kubeConfig, args)
+	if err != nil {
+		return nil, err
+	}
+	bind, err := GetBind(cmd)
+	if err != nil {
+		return nil, err
+	}
+	tf, err := GetTLSFiles(cmd)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewWatchClient(bind, reflect.TypeOf(b).String(), "", tf)
+	if err != nil {
+		return nil, err
+	}
+	if context, err = client.ResolveContext(context, kubeConfigFiles(kubeConfigFile)); err != nil {
+		return nil, err
+	}
+	return namespaceNames(client, context)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceExists(t *testing.T) {
+	names := []string{"default", "kube-system", "monitoring", "prod"}
+
+	assert.NoError(t, namespaceExists("ctx", "prod", names))
+	assert.NoError(t, namespaceExists("ctx", "PROD", names))
+	// without any namespaces to check against any namespace goes
+	assert.NoError(t, namespaceExists("ctx", "other", nil))
+
+	assert.EqualError(t, namespaceExists("ctx", "prd", names), `namespace "prd" not found in context ctx, did you mean "prod"?`)
+	assert.EqualError(t, namespaceExists("ctx", "defualt", names), `namespace "defualt" not found in context ctx, did you mean "default"?`)
+	assert.EqualError(t, namespaceExists("ctx", "kube-sytem", names), `namespace "kube-sytem" not found in context ctx, did you mean "kube-system"?`)
+	assert.EqualError(t, namespaceExists("ctx", "mon", names), `namespace "mon" not found in context ctx, did you mean "monitoring"?`)
+	assert.EqualError(t, namespaceExists("ctx", "staging", names), `namespace "staging" not found in context ctx`)
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("prod", "prod"))
+	assert.Equal(t, 1, editDistance("prd", "prod"))
+	assert.Equal(t, 1, editDistance("defualt", "default"))
+	assert.Equal(t, 3, editDistance("", "abc"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Pick one of kubeconfig's contexts at a prompt, each shown with what the watch server is doing for it
+func pickContext(b Builder, kubeConfig *api.Config, files []string, bind string, tf TLSFiles) (string, error) {
+	// the watch server is only asked how it's doing, it's launched once a context has been picked
+	var status *ServerStatus
+	watched := make(map[string]string)
+	if client, err := NewWatchClient(bind, reflect.TypeOf(b).String(), "", tf); err == nil {
+		if status, err = client.ServerStatus(""); err != nil {
+			log.WithField("error", err).Debug("failed to get the watch server's status")
+		}
+		for name := range kubeConfig.Contexts {
+			if ctx, err := client.ResolveContext(name, files); err == nil {
+				watched[name] = ctx
+			}
+		}
+	}
+
+	suggestions := contextSuggestions(kubeConfig, status, watched)
+	completer := func(in prompt.Document) []prompt.Suggest {
+		return prompt.FilterContains(suggestions, in.GetWordBeforeCursor(), true)
+	}
+
+	context := strings.TrimSpace(prompt.Input("[context] >> ", completer, promptOptions()...))
+	if context == "" {
+		return "", errors.New("no context was picked")
+	}
+	if _, ok := kubeConfig.Contexts[context]; !ok {
+		return "", fmt.Errorf("unknown context: %s", context)
+	}
+
+	return context, nil
+}
+
+// A suggestion for each of kubeconfig's contexts, sorted by name. The watch server knows a context by the name
+// it's mapped to in watched, or by its own name if it isn't in there
+func contextSuggestions(kubeConfig *api.Config, status *ServerStatus, watched map[string]string) []prompt.Suggest {
+	statuses := make(map[string]ContextStatus)
+	if status != nil {
+		for _, cs := range status.Contexts {
+			statuses[cs.Name] = cs
+		}
+	}
+
+	names := make([]string, 0, len(kubeConfig.Contexts))
+	for name := range kubeConfig.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s := make([]prompt.Suggest, 0, len(names))
+	for _, name := range names {
+		description := "not watched"
+		ctx, ok := watched[name]
+		if !ok {
+			ctx = name
+		}
+		if cs, ok := statuses[ctx]; ok {
+			description = describeContext(cs)
+		}
+		if name == kubeConfig.CurrentContext {
+			description = "current | " + description
+		}
+		s = append(s, prompt.Suggest{Text: name, Description: description})
+	}
+
+	return s
+}
+
+// How healthy the watch of a context is: whether its server has been reached, how many objects are cached
+// and how many kinds aren't being watched
+func describeContext(cs ContextStatus) string {
+	if cs.State != "" && cs.State != Watching {
+		if cs.LastError != "" {
+			return fmt.Sprintf("%s: %s", cs.State, cs.LastError)
+		}
+		return string(cs.State)
+	}
+
+	// a context held in the cache without a state hasn't been started, e.g. one only loaded from the snapshot
+	state := "cached"
+	if cs.State == Watching {
+		state = string(Watching)
+	}
+	parts := []string{state, fmt.Sprintf("%d objects", cs.Objects)}
+	failing := 0
+	for _, ks := range cs.Kinds {
+		if ks.State == BackingOff || ks.State == Failed {
+			failing++
+		}
+	}
+	if failing > 0 {
+		parts = append(parts, fmt.Sprintf("%d of %d kinds failing", failing, len(cs.Kinds)))
+	}
+
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestContextSuggestions(t *testing.T) {
+	kubeConfig, err := clientcmd.LoadFromFile("test_data/kubeconfig_proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := &ServerStatus{Contexts: []ContextStatus{{
+		Name:    "prod",
+		State:   Watching,
+		Objects: 42,
+		Kinds: []KindStatus{
+			{Kind: "node", State: Watching},
+			{Kind: "pod", State: BackingOff, LastError: "timeout"},
+		},
+	}, {
+		Name:      "dev",
+		State:     BackingOff,
+		LastError: "failed to ping server: timeout",
+	}}}
+
+	expected := []prompt.Suggest{
+		{Text: "broken", Description: "not watched"},
+		{Text: "dev", Description: "backing off: failed to ping server: timeout"},
+		{Text: "prod", Description: "current | watching | 42 objects | 1 of 2 kinds failing"},
+	}
+	assert.Equal(t, expected, contextSuggestions(kubeConfig, status, nil))
+
+	// the server's dev is another kubeconfig's
+	expected[1].Description = "not watched"
+	assert.Equal(t, expected, contextSuggestions(kubeConfig, status, map[string]string{"dev": "dev@/other/config"}))
+
+	// without a watch server running none are watched
+	expected = []prompt.Suggest{
+		{Text: "broken", Description: "not watched"},
+		{Text: "dev", Description: "not watched"},
+		{Text: "prod", Description: "current | not watched"},
+	}
+	assert.Equal(t, expected, contextSuggestions(kubeConfig, nil, nil))
+}
+
+func TestDescribeContext(t *testing.T) {
+	assert.Equal(t, "syncing", describeContext(ContextStatus{State: Syncing}))
+	assert.Equal(t, "cached | 3 objects", describeContext(ContextStatus{Objects: 3}))
+}
@@ -9,9 +9,10 @@ import (
 	"github.com/c-bata/go-prompt"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
 	"os"
 	"os/exec"
+	"reflect"
 	"strings"
 )
 
@@ -25,16 +26,29 @@ DESCRIPTION
 	the list of names and TAB or UP/DOWN to select one. Once you have selected
 	a name either hit ENTER to execute 'kubectl get' for the selected resource
 	or SPACE to select a further context sensitive argument from a list.
-	If a context is not specified then the active context from kubeconfig will be used.
+	If a context is not specified then the active context from kubeconfig will be used,
+	or with --pick-context a context is picked first from those in kubeconfig.
 
 	Supported resources are:
 		- pod, po, p (the default)
 		- log, lo, l
 		- node, no, n
+		- deployment, deploy
+		- service, svc
+		- configmap, cm
+		- namespace, ns (selecting one makes it the context's default namespace, like kubens)
 		- ssh (to exec into the selected Pod)
 
+	Any other resource, including CRDs, can be selected with --kind as long as the watch server
+	was started with it in --resources, e.g. 'kubectl ac resources --kind cert'
+
+	The namespace given with -n/--namespace is checked against the context's namespaces.
+
+	Use -l/--selector and --field-selector to only offer the resources matching them, like kubectl.
+
 	Example:
 		'kubectl ac log' will display a prompt so you can select from a list of Pod names the logs you want to show 
+		'kubectl ac log -l app=checkout' will only offer the checkout Pods
 `,
 		Aliases: getResourcesAliases(),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -47,45 +61,60 @@ DESCRIPTION
 
 	AddCommonFlags(cmd)
 	cmd.Flags().StringP("namespace", "n", "", "Retrieve resources for a specific namespace (default is all)")
+	cmd.RegisterFlagCompletionFunc("namespace", namespaceCompletion(b))
+	cmd.Flags().StringP("selector", "l", "", "Only offer resources matching the label selector, e.g. -l app=checkout")
+	cmd.Flags().String("field-selector", "", "Only offer resources matching the field selector, e.g. --field-selector spec.nodeName=node1,status.phase=Running")
+	cmd.Flags().StringP("kind", "k", "", "Kind of resource to select, for resources the watch server was told to watch with --resources (plural, singular or short name)")
+	cmd.Flags().Bool("pick-context", false, "If no context is specified, pick one of kubeconfig's contexts at a prompt rather than using the active one")
 	cmd.Flags().Bool("setproxy", true, "If true then set the HTTPS_PROXY env var to the kube context's proxy-url value (if available) before executing kubectl. This is only relevant if a proxy is required to access the Kube Master AND kubectl version is < v1.19")
 
 	return cmd
 }
 
 func RunResources(b Builder, cmd *cobra.Command, args []string) error {
-	var context, proxyURL string
-
-	b.SetCmdOptions(deriveCmdOptions(cmd.CalledAs()))
+	h, err := kindHandler(cmd)
+	if err != nil {
+		return err
+	}
+	b.SetCmdOptions(h.Options)
 
-	kubeConfigFile, err := cmd.Flags().GetString("kubeconfig")
+	kubeConfigFile, kubeConfig, err := loadKubeConfig(cmd)
 	if err != nil {
 		return err
 	}
-	kubeConfig, err := clientcmd.LoadFromFile(kubeConfigFile)
+	// a context that's going to be picked doesn't need kubeconfig to have an active one, which is when picking helps most
+	pick, err := cmd.Flags().GetBool("pick-context")
 	if err != nil {
 		return err
 	}
+	pick = pick && len(args) == 0
+	context := ""
+	if !pick {
+		if context, err = contextFromArgs(kubeConfig, args); err != nil {
+			return err
+		}
+	}
 
-	if len(args) > 1 {
-		return errors.New("only 1 context can be specified")
+	bind, err := GetBind(cmd)
+	if err != nil {
+		return fmt.Errorf("unexpected error: %s", err)
 	}
-	if len(args) == 0 {
-		// use the active context from kubeconfig
-		context = kubeConfig.CurrentContext
-		if strUtil.IsBlank(context) {
-			return fmt.Errorf("couldn't determine active context; please specify one")
-		}
-		proxyURL = kubeConfig.Clusters[context].ProxyURL
-	} else {
-		// check that the specified context exists, if so use it
-		if cluster, ok := kubeConfig.Clusters[args[0]]; ok {
-			context = args[0]
-			proxyURL = cluster.ProxyURL
-		} else {
-			return fmt.Errorf("unknown context: %s", args[0])
+
+	tf, err := GetTLSFiles(cmd)
+	if err != nil {
+		return err
+	}
+
+	if pick {
+		if context, err = pickContext(b, kubeConfig, kubeConfigFiles(kubeConfigFile), bind, tf); err != nil {
+			return err
 		}
 	}
 
+	proxyURL, err := proxyURLFor(kubeConfig, context)
+	if err != nil {
+		return err
+	}
 	if val, _ := cmd.Flags().GetBool("setproxy"); !val {
 		proxyURL = ""
 	}
@@ -96,11 +125,6 @@ func RunResources(b Builder, cmd *cobra.Command, args []string) error {
 	}
 	log.Debugf("using context: %s and namespace %s", context, ns)
 
-	bind, err := GetBind(cmd)
-	if err != nil {
-		return fmt.Errorf("unexpected error: %s", err)
-	}
-
 	isVerbose := false
 	isVeryVerbose := false
 	logLvlArg := ""
@@ -110,26 +134,61 @@ func RunResources(b Builder, cmd *cobra.Command, args []string) error {
 		logLvlArg = "--info"
 	}
 
-	client, err := b.WatchClient(bind, logLvlArg, kubeConfigFile, context)
+	// the watch server may know the context by another name, if its kubeconfig isn't this command's
+	watched := serverContext(b, bind, tf, kubeConfigFile, context)
+	client, err := b.WatchClient(bind, logLvlArg, kubeConfigFile, watched, tf)
 	if err != nil {
 		return err
 	}
 
-	wf := makeFilter(context, ns, realKind(cmd.CalledAs()))
+	if h.Namespaced() {
+		if err := checkNamespace(client, watched, ns); err != nil {
+			return err
+		}
+	}
+
+	wf := makeFilter(watched, ns, h.Kind())
+	if wf.LabelSelector, err = cmd.Flags().GetString("selector"); err != nil {
+		return err
+	}
+	if wf.FieldSelector, err = cmd.Flags().GetString("field-selector"); err != nil {
+		return err
+	}
 	kr, err := client.Resources(wf)
 	if err != nil {
 		return err
 	}
 	b.PopulateSuggestions(&kr)
 
-	kreq := deriveKindRequired(cmd.CalledAs())
-	if kreq == "log" || kreq == "ssh" {
+	// the resource type of a resource found through discovery is only known once the watch server has returned some
+	if _, registered := service.KindHandlerFor(h.Name()); !registered && len(kr) > 0 {
+		h = service.NewResourceTypeHandler(model.ResourceType{
+			Kind:       kr[0].Kind,
+			Group:      kr[0].Group,
+			Version:    kr[0].Version,
+			Namespaced: kr[0].Namespace != "",
+		})
+	}
+
+	if h.Name() == "log" || h.Name() == "ssh" {
 		populateContainerSuggestions(b, cmd.CalledAs(), &kr)
 	}
 
-	prefix := fmt.Sprintf("[%s] >> ", kreq)
+	prefix := fmt.Sprintf("[%s] >> ", h.Name())
+	in := prompt.Input(prefix, b.PodCompleter, promptOptions()...)
+
+	in = strings.TrimSpace(in)
+	log.Debugf("Your input: %s", in)
+	if strUtil.IsNotBlank(in) {
+		executor(context, h, in, proxyURL, kubeConfigFile)
+	}
+	return nil
+}
+
+// The options of the prompts the resources command shows
+func promptOptions() []prompt.Option {
 	writer := service.NewStdoutWriter()
-	in := prompt.Input(prefix, b.PodCompleter,
+	return []prompt.Option{
 		prompt.OptionWriter(writer),
 		prompt.OptionShowCompletionAtStart(),
 		// Set the colours for the prompt and suggestions
@@ -151,14 +210,70 @@ func RunResources(b Builder, cmd *cobra.Command, args []string) error {
 		prompt.OptionSelectedDescriptionTextColor(service.Themes["light"].OptionSelectedDescriptionTextColor),
 
 		prompt.OptionSuggestionTextColor(service.Themes["light"].OptionSuggestionTextColor),
-		prompt.OptionSuggestionBGColor(service.Themes["light"].OptionSuggestionBGColor))
+		prompt.OptionSuggestionBGColor(service.Themes["light"].OptionSuggestionBGColor),
+	}
+}
 
-	in = strings.TrimSpace(in)
-	log.Debugf("Your input: %s", in)
-	if strUtil.IsNotBlank(in) {
-		executor(context, kreq, in, proxyURL)
+// The kubeconfig file the command was given, blank if none was, and kubeconfig loaded the way kubectl does
+func loadKubeConfig(cmd *cobra.Command) (string, *api.Config, error) {
+	kubeConfigFile, err := cmd.Flags().GetString("kubeconfig")
+	if err != nil {
+		return "", nil, err
 	}
-	return nil
+	kubeConfig, err := loadingRules(kubeConfigFile).Load()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return kubeConfigFile, kubeConfig, nil
+}
+
+// The context named in the arguments, or else kubeconfig's active one
+func contextFromArgs(kubeConfig *api.Config, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", errors.New("only 1 context can be specified")
+	}
+	if len(args) == 0 {
+		if strUtil.IsBlank(kubeConfig.CurrentContext) {
+			return "", fmt.Errorf("couldn't determine active context; please specify one")
+		}
+		return kubeConfig.CurrentContext, nil
+	}
+	if _, ok := kubeConfig.Contexts[args[0]]; !ok {
+		return "", fmt.Errorf("unknown context: %s", args[0])
+	}
+
+	return args[0], nil
+}
+
+// The proxy to reach a context's server through, which is set on the cluster the context refers to
+func proxyURLFor(kubeConfig *api.Config, context string) (string, error) {
+	kubeCtx, ok := kubeConfig.Contexts[context]
+	if !ok {
+		return "", fmt.Errorf("unknown context: %s", context)
+	}
+	cluster, ok := kubeConfig.Clusters[kubeCtx.Cluster]
+	if !ok {
+		return "", fmt.Errorf("context %s refers to unknown cluster %s", context, kubeCtx.Cluster)
+	}
+
+	return cluster.ProxyURL, nil
+}
+
+// The context the running watch server knows the context by, just its name if the server isn't running - a server
+// launched for the context loads the same kubeconfig
+func serverContext(b Builder, bind string, tf TLSFiles, kubeConfigFile, context string) string {
+	client, err := NewWatchClient(bind, reflect.TypeOf(b).String(), "", tf)
+	if err != nil {
+		return context
+	}
+	watched, err := client.ResolveContext(context, kubeConfigFiles(kubeConfigFile))
+	if err != nil {
+		log.WithField("error", err).Debug("failed to resolve context, using its name")
+		return context
+	}
+
+	return watched
 }
 
 func makeFilter(context, ns, kind string) WatchFilter {
@@ -166,7 +281,7 @@ func makeFilter(context, ns, kind string) WatchFilter {
 		Context: context,
 		Kind:    kind,
 	}
-	if kind == "node" {
+	if h, ok := service.KindHandlerFor(kind); ok && !h.Namespaced() {
 		wf.Namespace = ""
 	} else {
 		wf.Namespace = ns
@@ -174,60 +289,9 @@ func makeFilter(context, ns, kind string) WatchFilter {
 
 	return wf
 }
-func executor(ctx, kind, in, proxyURL string) {
-
-	var (
-		cmdArgs        []string
-		getOrDescribe  string
-		sanitisedInput []string
-	)
-
-	input := strings.Split(in, " ")
-
-	switch {
-	case Contains(input, "@describe"):
-		getOrDescribe = "describe"
-		if kind == "node" {
-			// need to remove any elements after the node name
-			sanitisedInput = input[:1]
-		} else {
-			//need to remove all elements in the input slice to prevent kubectl errors (apart from 1st two: pod name & namespace)
-			sanitisedInput = input[:2]
-		}
-	default:
-		getOrDescribe = "get"
-		sanitisedInput = input
-	}
-
-	switch kind {
-	case "pod", "log":
-		ns := StringBetween(sanitisedInput[1], "[", "]")
-		if kind == "log" {
-			cmdArgs = []string{"logs"}
-		} else {
-			cmdArgs = []string{getOrDescribe, kind}
-		}
-		cmdArgs = append(cmdArgs, sanitisedInput[0], "--namespace", ns)
-		if len(sanitisedInput) > 2 {
-			cmdArgs = append(cmdArgs, sanitisedInput[2:]...)
-		}
-		cmdArgs = append(cmdArgs, "--context", fmt.Sprintf("%s", ctx))
-	case "ssh":
-		ns := StringBetween(sanitisedInput[1], "[", "]")
-		cmdArgs = []string{"exec", "-ti", sanitisedInput[0], "--namespace", ns, "--context", fmt.Sprintf("%s", ctx)}
-
-		// check if a container has been specified, if so add that to the exec command
-		if len(sanitisedInput) == 4 {
-			cmdArgs = append(cmdArgs, sanitisedInput[2:]...)
-		}
 
-		// the shell command always needs to go last
-		cmdArgs = append(cmdArgs, "--", "sh")
-	case "node":
-		cmdArgs = []string{getOrDescribe, kind}
-		cmdArgs = append(cmdArgs, sanitisedInput...)
-		cmdArgs = append(cmdArgs, "--context", fmt.Sprintf("%s", ctx))
-	}
+func executor(ctx string, h service.KindHandler, in, proxyURL, kubeConfigFile string) {
+	cmdArgs := withKubeConfig(h.Command(ctx, strings.Split(in, " ")), kubeConfigFile)
 
 	log.Debug(cmdArgs)
 	cmd := exec.Command("kubectl", cmdArgs...)
@@ -244,65 +308,55 @@ func executor(ctx, kind, in, proxyURL string) {
 	}
 }
 
-// once a pod name has been selected we want to provide context appropriate options
-// dependent on whether this cmd was called with 'pod' (to get details on the pod) or 'log'
-// (to get pod logs)
-func deriveCmdOptions(cmd string) cmdOptions {
-	kind := deriveKindRequired(cmd)
-	switch kind {
-	case "pod":
-		return getPodGetOptions
-	case "node":
-		return getNodeGetOptions
-	case "log":
-		return getLogOptions
-	case "ssh":
-		return getSSHOptions
-	default:
-		return getDefaultOptions
+// kubectl loads kubeconfig the same way by itself, it only has to be told about a file given in --kubeconfig. The
+// flag goes before any '--', after which the arguments are for the command run in the container (e.g. by ssh)
+func withKubeConfig(cmdArgs []string, kubeConfigFile string) []string {
+	if kubeConfigFile == "" {
+		return cmdArgs
 	}
-}
-
-func realKind(cmd string) string {
-	srcKind := deriveKindRequired(cmd)
-	if srcKind == "log" || srcKind == "ssh" {
-		return "pod"
+	flag := []string{"--kubeconfig", kubeConfigFile}
+	for i, arg := range cmdArgs {
+		if arg == "--" {
+			return append(append(append([]string{}, cmdArgs[:i]...), flag...), cmdArgs[i:]...)
+		}
 	}
 
-	return srcKind
+	return append(cmdArgs, flag...)
 }
 
-func deriveKindRequired(cmd string) string {
-	switch {
-	case strUtil.ContainsAny(cmd, getPodAliases()...):
-		return "pod"
-	case strUtil.ContainsAny(cmd, getNodeAliases()...):
-		return "node"
-	case strUtil.ContainsAny(cmd, getLogAliases()...):
-		return "log"
-	case strUtil.ContainsAny(cmd, getSSHAliases()...):
-		return "ssh"
-	case cmd == "resources":
-		return "pod"
-	default:
-		return ""
+// Work out which kind handler to use from the alias the command was called as, or from --kind.
+// Once a name has been selected the handler provides the context appropriate options, e.g. 'pod'
+// (to get details on the pod) or 'log' (to get pod logs)
+func kindHandler(cmd *cobra.Command) (service.KindHandler, error) {
+	name := deriveKindRequired(cmd.CalledAs())
+	kind, err := cmd.Flags().GetString("kind")
+	if err != nil {
+		return nil, err
+	}
+	if strUtil.IsNotBlank(kind) {
+		name = strings.ToLower(kind)
 	}
-}
 
-func getPodAliases() []string {
-	return []string{"pod", "p", "po"}
-}
+	if h, ok := service.KindHandlerFor(name); ok {
+		return h, nil
+	}
+	if strUtil.IsBlank(kind) {
+		return nil, fmt.Errorf("unsupported kind: %s", cmd.CalledAs())
+	}
 
-func getLogAliases() []string {
-	return []string{"logs", "log", "lo", "l"}
+	// leave it to the watch server to resolve the name of a resource found through discovery
+	return service.NewResourceTypeHandler(model.ResourceType{Kind: name, Namespaced: true}), nil
 }
 
-func getNodeAliases() []string {
-	return []string{"node", "no", "n"}
-}
+func deriveKindRequired(cmd string) string {
+	if cmd == "resources" {
+		return "pod"
+	}
+	if h, ok := service.KindHandlerFor(cmd); ok {
+		return h.Name()
+	}
 
-func getSSHAliases() []string {
-	return []string{"ssh"}
+	return ""
 }
 
 func populateContainerSuggestions(b Builder, cmd string, resources *[]model.KubeResource) {
@@ -322,9 +376,8 @@ func populateContainerSuggestions(b Builder, cmd string, resources *[]model.Kube
 
 func getResourcesAliases() []string {
 	var aliases []string
-	aliases = append(aliases, getPodAliases()...)
-	aliases = append(aliases, getLogAliases()...)
-	aliases = append(aliases, getNodeAliases()...)
-	aliases = append(aliases, getSSHAliases()...)
+	for _, h := range service.KindHandlers() {
+		aliases = append(aliases, h.Aliases()...)
+	}
 	return aliases
 }
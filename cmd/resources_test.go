@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"autocli/service"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/clientcmd"
+	"strings"
+	"testing"
+)
+
+func TestDeriveKindRequired(t *testing.T) {
+	tests := []struct {
+		cmd      string
+		expected string
+	}{
+		{cmd: "resources", expected: "pod"},
+		{cmd: "po", expected: "pod"},
+		{cmd: "no", expected: "node"},
+		{cmd: "deploy", expected: "deployment"},
+		{cmd: "deployment", expected: "deployment"},
+		{cmd: "svc", expected: "service"},
+		{cmd: "cm", expected: "configmap"},
+		{cmd: "ns", expected: "namespace"},
+		{cmd: "logs", expected: "log"},
+		{cmd: "ssh", expected: "ssh"},
+		{cmd: "other", expected: ""},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, deriveKindRequired(test.cmd), test.cmd)
+	}
+}
+
+func TestContextFromArgs(t *testing.T) {
+	kubeConfig, err := clientcmd.LoadFromFile("test_data/kubeconfig_proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	context, err := contextFromArgs(kubeConfig, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", context)
+	context, err = contextFromArgs(kubeConfig, []string{"dev"})
+	assert.NoError(t, err)
+	assert.Equal(t, "dev", context)
+
+	// cluster names aren't context names
+	_, err = contextFromArgs(kubeConfig, []string{"cluster_1"})
+	assert.EqualError(t, err, "unknown context: cluster_1")
+	_, err = contextFromArgs(kubeConfig, []string{"dev", "prod"})
+	assert.Error(t, err)
+
+	kubeConfig.CurrentContext = ""
+	_, err = contextFromArgs(kubeConfig, nil)
+	assert.Error(t, err)
+}
+
+func TestProxyURLFor(t *testing.T) {
+	kubeConfig, err := clientcmd.LoadFromFile("test_data/kubeconfig_proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxyURL, err := proxyURLFor(kubeConfig, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy.foo.com:3128", proxyURL)
+	proxyURL, err = proxyURLFor(kubeConfig, "dev")
+	assert.NoError(t, err)
+	assert.Equal(t, "", proxyURL)
+
+	_, err = proxyURLFor(kubeConfig, "broken")
+	assert.EqualError(t, err, "context broken refers to unknown cluster cluster_3")
+	_, err = proxyURLFor(kubeConfig, "other")
+	assert.Error(t, err)
+}
+
+func TestWithKubeConfig(t *testing.T) {
+	// a context from a kubeconfig file given in --kubeconfig, which kubectl has to load rather than sh in the container
+	h, _ := service.KindHandlerFor("ssh")
+	actual := withKubeConfig(h.Command("dev", []string{"mypod", "[myns]"}), "/home/me/.kube/team-b")
+	assert.Equal(t, "exec -ti mypod --namespace myns --context dev --kubeconfig /home/me/.kube/team-b -- sh", strings.Join(actual, " "))
+
+	h, _ = service.KindHandlerFor("pod")
+	actual = withKubeConfig(h.Command("dev", []string{"mypod", "[myns]"}), "/home/me/.kube/team-b")
+	assert.Equal(t, "get pod mypod --namespace myns --context dev --kubeconfig /home/me/.kube/team-b", strings.Join(actual, " "))
+	assert.Equal(t, []string{"get", "pod"}, withKubeConfig([]string{"get", "pod"}, ""))
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func NewRestartCommand(b Builder) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "restart [flags] [contexts]...",
+		Short: "Restart the watch server",
+		Long: `
+DESCRIPTION
+	Stop the watch server and start it again with the same flags, watching the
+	contexts it was watching or, if any are specified, those contexts instead.
+	A watch server that isn't running is started from its last state.
+`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := RunCommon(cmd); err != nil {
+				return err
+			}
+			return RunRestart(b, cmd, args)
+		},
+	}
+
+	AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func RunRestart(b Builder, cmd *cobra.Command, args []string) error {
+	tf, err := GetTLSFiles(cmd)
+	if err != nil {
+		return err
+	}
+
+	state, err := stopServer(b, tf)
+	if err != nil && err != errNotRunning {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("%s and there's no state to start it from; start it with 'kubectl-ac watch'", err)
+	}
+
+	contexts := state.Contexts
+	if len(args) > 0 {
+		contexts = args
+	}
+	if len(contexts) == 0 {
+		return fmt.Errorf("no contexts to watch; specify them with 'kubectl-ac restart [contexts]...'")
+	}
+
+	// the new server inherits $KUBECONFIG, so it has to be the one the server was started with to load the same files
+	os.Setenv("KUBECONFIG", state.KubeConfig)
+	log.WithField("flags", state.Flags).WithField("contexts", contexts).Debug("starting watch server")
+	if err := startWatchServer(append(append([]string{}, state.Flags...), contexts...)); err != nil {
+		return err
+	}
+
+	// wait for the new server to answer
+	var pid int
+	boff := backoff.NewExponentialBackOff()
+	boff.MaxElapsedTime = 10 * time.Second
+	err = backoff.Retry(func() error {
+		client, err := NewWatchClient(state.Address, reflect.TypeOf(b).String(), "", tf)
+		if err != nil {
+			return err
+		}
+		status, err := client.ServerStatus("")
+		if err != nil {
+			return err
+		}
+		pid = status.PID
+		return nil
+	}, boff)
+	if err != nil {
+		return fmt.Errorf("the watch server hasn't started: %s", err)
+	}
+	fmt.Fprintf(b.StdOut(), "watch server (PID %d) started\n", pid)
+
+	return nil
+}
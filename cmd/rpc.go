@@ -2,67 +2,173 @@ package cmd
 
 import (
 	"autocli/model"
+	"autocli/service"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net/rpc"
+	"os"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	strUtil "github.com/agrison/go-commons-lang/stringUtils"
 	log "github.com/sirupsen/logrus"
 )
 
 type WatchCache struct {
-	resources map[string][]model.KubeResource
-	mu        *sync.RWMutex
+	// the resources held for each context
+	resources map[string]*resourceStore
+	// the names of resource types found through discovery, mapped to the kind stored in the cache, per context
+	kindAliases map[string]map[string]string
+	// the resourceVersion of the latest listing, per context
+	resourceVersions map[string]string
+	// the kinds whose entries were loaded from a snapshot and haven't been listed from the cluster since, per context
+	stale map[string]map[string]bool
+	// what the watch of each kind is doing, per context
+	watchStates map[string]map[string]*kindState
+	// whether each context's server has been reached
+	contextStates map[string]*kindState
+	startedAt     time.Time
+	// starts and stops watching contexts on behalf of clients, nil if the cache isn't backed by a watch server
+	watcher contextWatcher
+	// shuts the watch server down, nil if the cache isn't backed by a watch server
+	shutdown func()
+	mu       *sync.RWMutex
+	// when each context was last queried, and when any was, so idle contexts can be dropped
+	lastQueried map[string]time.Time
+	lastQuery   time.Time
+	queriedMu   *sync.Mutex
+}
+
+type contextWatcher interface {
+	addContext(ctx string) error
+	removeContext(ctx string) error
+	contextNames() []string
+	contextFor(name string, files []string) string
+}
+
+// A context as a client knows it: its name and the kubeconfig files the client loads, in the order they take precedence
+type ContextRef struct {
+	Name  string
+	Files []string
 }
 
 type WatchFilter struct {
 	Context   string
 	Namespace string
 	Kind      string
+	// a label selector like kubectl's -l, e.g. app=checkout,tier!=cache
+	LabelSelector string
+	// a field selector like kubectl's --field-selector, e.g. spec.nodeName=node1
+	FieldSelector string
 }
 
-func (c *WatchCache) deleteKubeObjects(s string, kind string) {
+/*
+Map the names of a resource type found through discovery to the kind it's cached as. The names of a registered
+handler stay its own, as does the plural of a kind named like one - e.g. 'services' for a Knative service - and
+a name two resource types share stays the first one's. The others are still found by the names qualified by their group
+*/
+func (c *WatchCache) registerResourceType(s string, rt model.ResourceType) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	os, ok := c.resources[s]
+	aliases, ok := c.kindAliases[s]
 	if !ok {
-		return
+		aliases = make(map[string]string)
+		c.kindAliases[s] = aliases
 	}
-
-	newObjects := []model.KubeResource{}
-	for i := range os {
-		if os[i].Kind != kind {
-			newObjects = append(newObjects, os[i])
+	kind := service.WatchedKind(rt)
+	_, registered := service.KindHandlerFor(rt.Kind)
+	shadowed := registered && kind != rt.Kind
+	for _, a := range rt.Aliases() {
+		a = strings.ToLower(a)
+		if _, taken := aliases[a]; taken || (shadowed && a == rt.Resource) {
+			continue
+		}
+		if h, ok := service.KindHandlerFor(a); ok && h.Kind() != kind {
+			continue
 		}
+		aliases[a] = kind
 	}
+}
 
-	c.resources[s] = newObjects
+// Translate the kind requested by a client into the kind held in the cache, e.g. 'certs' into 'certificate.cert-manager.io'
+func (c *WatchCache) kindFor(s string, kind string) string {
+	if k, ok := c.kindAliases[s][strings.ToLower(kind)]; ok {
+		return k
+	}
+
+	return kind
 }
 
-func (c *WatchCache) deleteKubeObject(s string, o model.KubeResource) {
+func (c *WatchCache) deleteKubeObjects(s string, kind string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	os, ok := c.resources[s]
-	if !ok {
-		return
+	if store, ok := c.resources[s]; ok {
+		store.removeKind(kind)
 	}
+}
 
-	idx := -1
-	for i := range os {
-		if os[i].Name == o.Name && os[i].Namespace == o.Namespace {
-			idx = i
-			break
-		}
+// Swap all the objects of a kind in one go, so the cache is never empty for that kind while it's being refreshed
+func (c *WatchCache) replaceKubeObjects(s string, kind string, objects []model.KubeResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	store := c.storeFor(s)
+	store.removeKind(kind)
+	for _, o := range objects {
+		store.put(o)
+	}
+
+	if c.stale[s][kind] {
+		log.WithField("context", s).WithField("kind", kind).Info("snapshot entries replaced by a full listing")
+		delete(c.stale[s], kind)
+	}
+}
+
+// Forget everything held for a context
+func (c *WatchCache) removeContext(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.resources, s)
+	delete(c.kindAliases, s)
+	delete(c.resourceVersions, s)
+	delete(c.stale, s)
+	delete(c.watchStates, s)
+	delete(c.contextStates, s)
+
+	c.queriedMu.Lock()
+	delete(c.lastQueried, s)
+	c.queriedMu.Unlock()
+}
+
+func (c *WatchCache) setResourceVersion(s string, rv string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if rv != "" {
+		c.resourceVersions[s] = rv
 	}
+}
 
-	if idx >= 0 {
-		os = append(os[:idx], os[idx+1:]...)
-		c.resources[s] = os
+func (c *WatchCache) resourceVersion(s string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.resourceVersions[s]
+}
+
+func (c *WatchCache) deleteKubeObject(s string, o model.KubeResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if store, ok := c.resources[s]; ok {
+		store.remove(keyOf(o))
 	}
 }
 
@@ -70,24 +176,31 @@ func (c *WatchCache) updateKubeObject(s string, o model.KubeResource) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	os, ok := c.resources[s]
+	c.storeFor(s).put(o)
+}
+
+// The store for a context, created on first use. The caller must hold the write lock
+func (c *WatchCache) storeFor(s string) *resourceStore {
+	store, ok := c.resources[s]
 	if !ok {
-		os = make([]model.KubeResource, 0)
+		store = newResourceStore()
+		c.resources[s] = store
 	}
 
-	found := false
-	for i := range os {
-		if os[i].Name == o.Name && os[i].Namespace == o.Namespace && os[i].Kind == o.Kind {
-			os[i] = o
-			found = true
-			break
-		}
-	}
+	return store
+}
+
+// All the resources held for a context, sorted by kind, namespace and name
+func (c *WatchCache) objects(s string) []model.KubeResource {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	if !found {
-		os = append(os, o)
+	store, ok := c.resources[s]
+	if !ok {
+		return nil
 	}
-	c.resources[s] = os
+
+	return store.list()
 }
 
 func (c *WatchCache) Resources(f *WatchFilter, kr *[]model.KubeResource) error {
@@ -98,6 +211,10 @@ func (c *WatchCache) Resources(f *WatchFilter, kr *[]model.KubeResource) error {
 	if f == nil {
 		return errors.New("cannot find resources with nil filter")
 	}
+	ls, fs, err := parseSelectors(f)
+	if err != nil {
+		return err
+	}
 
 	keys := []string{}
 
@@ -112,12 +229,13 @@ func (c *WatchCache) Resources(f *WatchFilter, kr *[]model.KubeResource) error {
 	}
 
 	sort.Strings(keys)
+	c.touch(keys...)
 
 	res := []model.KubeResource{}
 	for _, k := range keys {
-		for _, r := range c.resources[k] {
-			if strings.EqualFold(r.Kind, f.Kind) &&
-				(f.Namespace == "" || r.Kind == "namespace" || strings.EqualFold(r.Namespace, f.Namespace)) {
+		kind := c.kindFor(k, f.Kind)
+		for _, r := range c.resources[k].query(kind, f.Namespace) {
+			if selects(r, ls, fs) {
 				res = append(res, r)
 			}
 		}
@@ -135,25 +253,163 @@ func (c *WatchCache) Status(ctx *string, ct *int) error {
 		return errors.New("context cannot be blank")
 	}
 
-	if res, exists := c.resources[*ctx]; exists {
-		*ct = len(res)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if store, exists := c.resources[*ctx]; exists {
+		c.touch(*ctx)
+		*ct = store.len()
 		return nil
+	} else if cs, ok := c.contextStates[*ctx]; ok && cs.lastError != "" {
+		return fmt.Errorf("kube context %s isn't available yet: %s", *ctx, cs.lastError)
 	} else {
 		return fmt.Errorf("kube context %s not found", *ctx)
 	}
 
 }
 
+// The state of the server and of the watches of every context, or just the one specified if it isn't blank
+func (c *WatchCache) ServerStatus(ctx *string, status *ServerStatus) error {
+	log.WithField("context", ctx).Debug("Received request for server status")
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	contexts := []string{}
+	for s := range c.resources {
+		contexts = append(contexts, s)
+	}
+	for s := range c.watchStates {
+		if _, ok := c.resources[s]; !ok {
+			contexts = append(contexts, s)
+		}
+	}
+	for s := range c.contextStates {
+		_, cached := c.resources[s]
+		if _, watched := c.watchStates[s]; !cached && !watched {
+			contexts = append(contexts, s)
+		}
+	}
+	sort.Strings(contexts)
+
+	status.PID = os.Getpid()
+	status.Version = BuildVersion
+	status.StartedAt = c.startedAt
+	status.Uptime = time.Since(c.startedAt).Round(time.Second).String()
+	status.Contexts = []ContextStatus{}
+	for _, s := range contexts {
+		if strUtil.IsBlank(*ctx) || strings.EqualFold(*ctx, s) {
+			status.Contexts = append(status.Contexts, c.contextStatus(s))
+		}
+	}
+	if strUtil.IsNotBlank(*ctx) && len(status.Contexts) == 0 {
+		return fmt.Errorf("kube context %s not found", *ctx)
+	}
+
+	return nil
+}
+
+// Start watching a context the server isn't watching yet. The contexts being watched are returned
+func (c *WatchCache) AddContext(ctx *string, contexts *[]string) error {
+	log.WithField("context", ctx).Debug("Received request to add context")
+	if strUtil.IsBlank(*ctx) {
+		return errors.New("context cannot be blank")
+	}
+	if c.watcher == nil {
+		return errors.New("contexts cannot be added to this server")
+	}
+
+	if err := c.watcher.addContext(*ctx); err != nil {
+		log.WithField("context", *ctx).WithField("error", err).Error("failed to add context")
+		return err
+	}
+	*contexts = c.watcher.contextNames()
+
+	return nil
+}
+
+// Stop watching a context and drop its resources from the cache. The contexts still being watched are returned
+func (c *WatchCache) RemoveContext(ctx *string, contexts *[]string) error {
+	log.WithField("context", ctx).Debug("Received request to remove context")
+	if strUtil.IsBlank(*ctx) {
+		return errors.New("context cannot be blank")
+	}
+	if c.watcher == nil {
+		return errors.New("contexts cannot be removed from this server")
+	}
+
+	if err := c.watcher.removeContext(*ctx); err != nil {
+		return err
+	}
+	*contexts = c.watcher.contextNames()
+
+	return nil
+}
+
+// The context the server knows the client's context by, which is what the client asks for resources of: the
+// context's name unless the client's kubeconfig defines it in a different file to the server's
+func (c *WatchCache) ResolveContext(ref *ContextRef, ctx *string) error {
+	log.WithField("context", ref.Name).Debug("Received request to resolve context")
+	if strUtil.IsBlank(ref.Name) {
+		return errors.New("context cannot be blank")
+	}
+	if c.watcher == nil {
+		*ctx = ref.Name
+		return nil
+	}
+	*ctx = c.watcher.contextFor(ref.Name, ref.Files)
+
+	return nil
+}
+
+// The contexts being watched, the argument is ignored
+func (c *WatchCache) ListContexts(_ *string, contexts *[]string) error {
+	log.Debug("Received request to list contexts")
+	if c.watcher == nil {
+		*contexts = []string{}
+		return nil
+	}
+	*contexts = c.watcher.contextNames()
+
+	return nil
+}
+
+// Shut the watch server down, it starts to stop as the reply is sent. The argument is ignored
+func (c *WatchCache) Shutdown(_ *string, ok *bool) error {
+	log.Info("Received request to shut down")
+	if c.shutdown == nil {
+		return errors.New("not backed by a watch server")
+	}
+	c.shutdown()
+	*ok = true
+
+	return nil
+}
+
 func NewWatchCache() *WatchCache {
 	c := &WatchCache{}
 	c.mu = &sync.RWMutex{}
-	c.resources = make(map[string][]model.KubeResource)
+	c.resources = make(map[string]*resourceStore)
+	c.kindAliases = make(map[string]map[string]string)
+	c.resourceVersions = make(map[string]string)
+	c.stale = make(map[string]map[string]bool)
+	c.watchStates = make(map[string]map[string]*kindState)
+	c.contextStates = make(map[string]*kindState)
+	c.startedAt = time.Now()
+	c.lastQueried = make(map[string]time.Time)
+	c.lastQuery = c.startedAt
+	c.queriedMu = &sync.Mutex{}
 	return c
 }
 
 type WatchClient interface {
 	Resources(f WatchFilter) ([]model.KubeResource, error)
 	Status(c string) (int, error)
+	ServerStatus(c string) (*ServerStatus, error)
+	AddContext(c string) error
+	RemoveContext(c string) error
+	ListContexts() ([]string, error)
+	ResolveContext(name string, files []string) (string, error)
+	Shutdown() error
 }
 
 type WatchClientDefault struct {
@@ -161,15 +417,23 @@ type WatchClientDefault struct {
 	builderType string
 }
 
-func NewWatchClient(address, builderType, rpcPath string) (*WatchClientDefault, error) {
+func NewWatchClient(address, builderType, rpcPath string, tf TLSFiles) (*WatchClientDefault, error) {
 	var connection *rpc.Client
 	var err error
 
 	if strUtil.IsBlank(rpcPath) {
-		connection, err = rpc.DialHTTP("tcp", address)
-	} else {
-		connection, err = rpc.DialHTTPPath("tcp", address, rpcPath)
+		rpcPath = rpc.DefaultRPCPath
+	}
+	// anyone on the host can connect over TCP, so the server wants a token
+	network, address := splitBind(address)
+	token := clientToken(network, address, tf)
+	var tlsConfig *tls.Config
+	if tf.enabled() {
+		if tlsConfig, err = clientTLSConfig(tf); err != nil {
+			return nil, err
+		}
 	}
+	connection, err = dialHTTP(network, address, rpcPath, token, tlsConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -197,3 +461,55 @@ func (wc *WatchClientDefault) Status(c string) (int, error) {
 	}
 	return resourceCount, err
 }
+
+func (wc *WatchClientDefault) ServerStatus(c string) (*ServerStatus, error) {
+	status := &ServerStatus{}
+	sm := wc.builderType + ".ServerStatus"
+	err := wc.conn.Call(sm, c, status)
+	return status, err
+}
+
+func (wc *WatchClientDefault) AddContext(c string) error {
+	var contexts []string
+	sm := wc.builderType + ".AddContext"
+	err := wc.conn.Call(sm, c, &contexts)
+	if err == nil {
+		log.Debugf("Watch server now watching contexts: %v", contexts)
+	}
+	return err
+}
+
+func (wc *WatchClientDefault) RemoveContext(c string) error {
+	var contexts []string
+	sm := wc.builderType + ".RemoveContext"
+	err := wc.conn.Call(sm, c, &contexts)
+	if err == nil {
+		log.Debugf("Watch server now watching contexts: %v", contexts)
+	}
+	return err
+}
+
+func (wc *WatchClientDefault) ListContexts() ([]string, error) {
+	var contexts []string
+	sm := wc.builderType + ".ListContexts"
+	err := wc.conn.Call(sm, "", &contexts)
+	return contexts, err
+}
+
+func (wc *WatchClientDefault) ResolveContext(name string, files []string) (string, error) {
+	var ctx string
+	sm := wc.builderType + ".ResolveContext"
+	err := wc.conn.Call(sm, &ContextRef{Name: name, Files: files}, &ctx)
+	return ctx, err
+}
+
+// Ask the watch server to shut down. It may close the connection before the reply gets back, which is as good as one
+func (wc *WatchClientDefault) Shutdown() error {
+	var ok bool
+	sm := wc.builderType + ".Shutdown"
+	err := wc.conn.Call(sm, "", &ok)
+	if err == rpc.ErrShutdown || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
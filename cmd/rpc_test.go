@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"autocli/model"
+	"fmt"
 	v1 "k8s.io/api/core/v1"
 	"net"
 	"net/http"
@@ -27,12 +28,13 @@ func setupRPC() {
 	b := &DefaultBuilder{}
 	cache := b.WatchCache()
 	fillCache(cache)
+	cache.watcher = &testWatcher{contexts: []string{"ctx1", "ctx2", "ctx3"}}
 	rpc.RegisterName("*cmd.DefaultBuilder", cache)
 	rpc.DefaultServer.HandleHTTP("/rpctest", "/rpcdebug")
 
 	go http.Serve(l, nil)
 
-	watchClient, err = NewWatchClient(l.Addr().String(), "*cmd.DefaultBuilder", "/rpctest")
+	watchClient, err = NewWatchClient(l.Addr().String(), "*cmd.DefaultBuilder", "/rpctest", TLSFiles{})
 	if err != nil {
 		log.Fatalf("Failed to create WatchClient: %v", err)
 	}
@@ -44,15 +46,11 @@ func fillCache(c *WatchCache) {
 		for _, ns := range []string{"ns1", "ns2", "ns3"} {
 			for _, kind := range []string{"pod", "service", "deployment"} {
 				for _, name := range []string{"a", "b", "c"} {
-					if c.resources[ctx] == nil {
-						c.resources[ctx] = make([]model.KubeResource, 0)
-					}
-
 					r := model.KubeResource{
 						model.TypeMeta{Kind: kind},
 						model.ResourceMeta{Name: ctx + "-" + name, Namespace: ns, Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}},
 					}
-					c.resources[ctx] = append(c.resources[ctx], r)
+					c.updateKubeObject(ctx, r)
 				}
 			}
 		}
@@ -61,10 +59,10 @@ func fillCache(c *WatchCache) {
 	for _, ctx := range []string{"ctx1", "ctx2"} {
 		for _, ns := range []string{"ns1", "ns2"} {
 			r := model.KubeResource{
-				model.TypeMeta{"namespace"},
+				model.TypeMeta{Kind: "namespace"},
 				model.ResourceMeta{Name: ctx + "-" + ns, Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}},
 			}
-			c.resources[ctx] = append(c.resources[ctx], r)
+			c.updateKubeObject(ctx, r)
 		}
 	}
 }
@@ -103,87 +101,87 @@ func TestClientResources(t *testing.T) {
 			},
 		},
 		{
-			filter: WatchFilter{"CTX1", "ns1", "pod"},
+			filter: WatchFilter{Context: "CTX1", Namespace: "ns1", Kind: "pod"},
 			expected: []model.KubeResource{
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-a", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-b", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-c", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-a", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-b", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-c", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
 			},
 		},
 		{
-			filter: WatchFilter{"ctx2", "NS1", "pod"},
+			filter: WatchFilter{Context: "ctx2", Namespace: "NS1", Kind: "pod"},
 			expected: []model.KubeResource{
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx2-a", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx2-b", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx2-c", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx2-a", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx2-b", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx2-c", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
 			},
 		},
 		{
-			filter: WatchFilter{"ctx1", "ns2", "POD"},
+			filter: WatchFilter{Context: "ctx1", Namespace: "ns2", Kind: "POD"},
 			expected: []model.KubeResource{
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-a", "ns2", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-b", "ns2", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-c", "ns2", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-a", Namespace: "ns2", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-b", Namespace: "ns2", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-c", Namespace: "ns2", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
 			},
 		},
 		{
-			filter: WatchFilter{"ctx1", "ns1", "service"},
+			filter: WatchFilter{Context: "ctx1", Namespace: "ns1", Kind: "service"},
 			expected: []model.KubeResource{
-				{model.TypeMeta{"service"}, model.ResourceMeta{"ctx1-a", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"service"}, model.ResourceMeta{"ctx1-b", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"service"}, model.ResourceMeta{"ctx1-c", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "service"}, model.ResourceMeta{Name: "ctx1-a", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "service"}, model.ResourceMeta{Name: "ctx1-b", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "service"}, model.ResourceMeta{Name: "ctx1-c", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
 			},
 		},
 		{
-			filter: WatchFilter{"ctx1", "ns1", "deployment"},
+			filter: WatchFilter{Context: "ctx1", Namespace: "ns1", Kind: "deployment"},
 			expected: []model.KubeResource{
-				{model.TypeMeta{"deployment"}, model.ResourceMeta{"ctx1-a", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"deployment"}, model.ResourceMeta{"ctx1-b", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"deployment"}, model.ResourceMeta{"ctx1-c", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "deployment"}, model.ResourceMeta{Name: "ctx1-a", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "deployment"}, model.ResourceMeta{Name: "ctx1-b", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "deployment"}, model.ResourceMeta{Name: "ctx1-c", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
 			},
 		},
 		{
-			filter: WatchFilter{"", "ns1", "pod"},
+			filter: WatchFilter{Context: "", Namespace: "ns1", Kind: "pod"},
 			expected: []model.KubeResource{
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-a", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-b", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-c", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx2-a", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx2-b", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx2-c", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx3-a", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx3-b", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx3-c", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-a", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-b", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-c", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx2-a", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx2-b", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx2-c", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx3-a", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx3-b", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx3-c", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
 			},
 		},
 		{
-			filter: WatchFilter{"ctx1", "", "pod"},
+			filter: WatchFilter{Context: "ctx1", Namespace: "", Kind: "pod"},
 			expected: []model.KubeResource{
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-a", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-b", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-c", "ns1", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-a", "ns2", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-b", "ns2", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-c", "ns2", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-a", "ns3", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-b", "ns3", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"pod"}, model.ResourceMeta{"ctx1-c", "ns3", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-a", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-b", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-c", Namespace: "ns1", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-a", Namespace: "ns2", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-b", Namespace: "ns2", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-c", Namespace: "ns2", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-a", Namespace: "ns3", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-b", Namespace: "ns3", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "pod"}, model.ResourceMeta{Name: "ctx1-c", Namespace: "ns3", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
 			},
 		},
 		{
-			filter: WatchFilter{"ctx1", "should be ignored", "namespace"},
+			filter: WatchFilter{Context: "ctx1", Namespace: "should be ignored", Kind: "namespace"},
 			expected: []model.KubeResource{
-				{model.TypeMeta{"namespace"}, model.ResourceMeta{"ctx1-ns1", "", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"namespace"}, model.ResourceMeta{"ctx1-ns2", "", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "namespace"}, model.ResourceMeta{Name: "ctx1-ns1", Namespace: "", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "namespace"}, model.ResourceMeta{Name: "ctx1-ns2", Namespace: "", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
 			},
 		},
 		{
-			filter: WatchFilter{"", "should be ignored", "namespace"},
+			filter: WatchFilter{Context: "", Namespace: "should be ignored", Kind: "namespace"},
 			expected: []model.KubeResource{
-				{model.TypeMeta{"namespace"}, model.ResourceMeta{"ctx1-ns1", "", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"namespace"}, model.ResourceMeta{"ctx1-ns2", "", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"namespace"}, model.ResourceMeta{"ctx2-ns1", "", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
-				{model.TypeMeta{"namespace"}, model.ResourceMeta{"ctx2-ns2", "", "", string(v1.PodRunning), []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "namespace"}, model.ResourceMeta{Name: "ctx1-ns1", Namespace: "", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "namespace"}, model.ResourceMeta{Name: "ctx1-ns2", Namespace: "", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "namespace"}, model.ResourceMeta{Name: "ctx2-ns1", Namespace: "", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
+				{model.TypeMeta{Kind: "namespace"}, model.ResourceMeta{Name: "ctx2-ns2", Namespace: "", ResourceVersion: "", Status: string(v1.PodRunning), ContainerNames: []model.ContainerMeta{{"a", "a"}}}},
 			},
 		},
 	}
@@ -228,16 +226,79 @@ func TestClientStatus(t *testing.T) {
 	}
 }
 
+type testWatcher struct {
+	contexts []string
+}
+
+func (w *testWatcher) addContext(ctx string) error {
+	if ctx == "unknown" {
+		return fmt.Errorf("context %s not found in kubeconfig", ctx)
+	}
+	if !Contains(w.contexts, ctx) {
+		w.contexts = append(w.contexts, ctx)
+	}
+	return nil
+}
+
+func (w *testWatcher) removeContext(ctx string) error {
+	for i := range w.contexts {
+		if w.contexts[i] == ctx {
+			w.contexts = append(w.contexts[:i], w.contexts[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("context %s is not being watched", ctx)
+}
+
+func (w *testWatcher) contextNames() []string {
+	return append([]string{}, w.contexts...)
+}
+
+func (w *testWatcher) contextFor(name string, files []string) string {
+	if Contains(files, "/other/config") {
+		return qualifiedContext(name, []string{"/other/config"})
+	}
+	return name
+}
+
+func TestClientContexts(t *testing.T) {
+	once.Do(setupRPC)
+
+	contexts, err := watchClient.ListContexts()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ctx1", "ctx2", "ctx3"}, contexts)
+
+	assert.NoError(t, watchClient.AddContext("ctx4"))
+	assert.Error(t, watchClient.AddContext("unknown"))
+	assert.Error(t, watchClient.AddContext(""))
+	contexts, _ = watchClient.ListContexts()
+	assert.Equal(t, []string{"ctx1", "ctx2", "ctx3", "ctx4"}, contexts)
+
+	assert.NoError(t, watchClient.RemoveContext("ctx4"))
+	assert.Error(t, watchClient.RemoveContext("ctx4"))
+	contexts, _ = watchClient.ListContexts()
+	assert.Equal(t, []string{"ctx1", "ctx2", "ctx3"}, contexts)
+
+	ctx, err := watchClient.ResolveContext("ctx1", []string{"/home/me/.kube/config"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ctx1", ctx)
+	ctx, err = watchClient.ResolveContext("ctx1", []string{"/other/config"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ctx1@/other/config", ctx)
+	_, err = watchClient.ResolveContext("", nil)
+	assert.Error(t, err)
+}
+
 func TestDeleteKubeObjects(t *testing.T) {
 	c := NewWatchCache()
 	s := "s"
-	o1 := model.KubeResource{TypeMeta: model.TypeMeta{"x"}, ResourceMeta: model.ResourceMeta{Name: "x1"}}
-	o2 := model.KubeResource{TypeMeta: model.TypeMeta{"y"}, ResourceMeta: model.ResourceMeta{Name: "y1"}}
+	o1 := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "x"}, ResourceMeta: model.ResourceMeta{Name: "x1"}}
+	o2 := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "y"}, ResourceMeta: model.ResourceMeta{Name: "y1"}}
 	c.updateKubeObject(s, o1)
 	c.updateKubeObject(s, o2)
 
 	c.deleteKubeObjects(s, "y")
-	assert.Equal(t, []model.KubeResource{o1}, c.resources[s])
+	assert.Equal(t, []model.KubeResource{o1}, c.objects(s))
 }
 
 func TestUpdateKubeObject(t *testing.T) {
@@ -245,14 +306,216 @@ func TestUpdateKubeObject(t *testing.T) {
 	s := "s"
 
 	expected := []model.KubeResource{
-		{TypeMeta: model.TypeMeta{"x"}, ResourceMeta: model.ResourceMeta{Name: "x1"}},
-		{TypeMeta: model.TypeMeta{"y"}, ResourceMeta: model.ResourceMeta{Name: "x1"}},
-		{TypeMeta: model.TypeMeta{"y"}, ResourceMeta: model.ResourceMeta{Name: "x1", Namespace: "ns2"}},
+		{TypeMeta: model.TypeMeta{Kind: "x"}, ResourceMeta: model.ResourceMeta{Name: "x1"}},
+		{TypeMeta: model.TypeMeta{Kind: "y"}, ResourceMeta: model.ResourceMeta{Name: "x1"}},
+		{TypeMeta: model.TypeMeta{Kind: "y"}, ResourceMeta: model.ResourceMeta{Name: "x1", Namespace: "ns2"}},
 	}
 
 	for i := range expected {
 		c.updateKubeObject(s, expected[i])
 	}
 
-	assert.Equal(t, expected, c.resources[s])
+	assert.Equal(t, expected, c.objects(s))
+}
+
+func TestReplaceKubeObjects(t *testing.T) {
+	c := NewWatchCache()
+	s := "s"
+	o1 := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "x"}, ResourceMeta: model.ResourceMeta{Name: "x1"}}
+	o2 := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "y"}, ResourceMeta: model.ResourceMeta{Name: "y1"}}
+	o3 := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "y"}, ResourceMeta: model.ResourceMeta{Name: "y2"}}
+	c.updateKubeObject(s, o1)
+	c.updateKubeObject(s, o2)
+
+	c.replaceKubeObjects(s, "y", []model.KubeResource{o3})
+	assert.Equal(t, []model.KubeResource{o1, o3}, c.objects(s))
+}
+
+func TestResourcesByAlias(t *testing.T) {
+	c := NewWatchCache()
+	s := "s"
+	o1 := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "certificate", Group: "cert-manager.io", Version: "v1"}, ResourceMeta: model.ResourceMeta{Name: "c1", Namespace: "ns1"}}
+	o2 := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "clusterissuer", Group: "cert-manager.io", Version: "v1"}, ResourceMeta: model.ResourceMeta{Name: "ci1"}}
+	c.updateKubeObject(s, o1)
+	c.updateKubeObject(s, o2)
+	c.registerResourceType(s, model.ResourceType{Kind: "certificate", Group: "cert-manager.io", Resource: "certificates", ShortNames: []string{"cert"}})
+	c.registerResourceType(s, model.ResourceType{Kind: "clusterissuer", Group: "cert-manager.io", Resource: "clusterissuers"})
+
+	for _, alias := range []string{"cert", "Certificates", "certificate.cert-manager.io"} {
+		var actual []model.KubeResource
+		err := c.Resources(&WatchFilter{Context: s, Namespace: "ns1", Kind: alias}, &actual)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.KubeResource{o1}, actual, alias)
+	}
+
+	// cluster scoped resources ignore the namespace
+	var actual []model.KubeResource
+	err := c.Resources(&WatchFilter{Context: s, Namespace: "ns1", Kind: "clusterissuers"}, &actual)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.KubeResource{o2}, actual)
+}
+
+func TestResourcesSameNameOtherGroup(t *testing.T) {
+	c := NewWatchCache()
+	s := "s"
+	svc := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "service"}, ResourceMeta: model.ResourceMeta{Name: "web", Namespace: "ns1"}}
+	ksvc := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "service", Group: "serving.knative.dev", Version: "v1"}, ResourceMeta: model.ResourceMeta{Name: "web", Namespace: "ns1"}}
+	c.updateKubeObject(s, svc)
+	c.updateKubeObject(s, ksvc)
+	c.registerResourceType(s, model.ResourceType{Kind: "service", Group: "serving.knative.dev", Resource: "services", ShortNames: []string{"ksvc"}})
+
+	// the built-in kind keeps its names
+	var actual []model.KubeResource
+	for _, alias := range []string{"service", "Service"} {
+		assert.NoError(t, c.Resources(&WatchFilter{Context: s, Kind: alias}, &actual))
+		assert.Equal(t, []model.KubeResource{svc}, actual, alias)
+	}
+	for _, alias := range []string{"ksvc", "service.serving.knative.dev", "services.serving.knative.dev"} {
+		assert.NoError(t, c.Resources(&WatchFilter{Context: s, Kind: alias}, &actual))
+		assert.Equal(t, []model.KubeResource{ksvc}, actual, alias)
+	}
+
+	// replacing one leaves the other alone
+	c.replaceKubeObjects(s, "service.serving.knative.dev", nil)
+	assert.Equal(t, []model.KubeResource{svc}, c.objects(s))
+}
+
+func TestDeleteKubeObject(t *testing.T) {
+	c := NewWatchCache()
+	s := "s"
+	pod := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "pod"}, ResourceMeta: model.ResourceMeta{Name: "a", Namespace: "ns1"}}
+	svc := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "service"}, ResourceMeta: model.ResourceMeta{Name: "a", Namespace: "ns1"}}
+	c.updateKubeObject(s, pod)
+	c.updateKubeObject(s, svc)
+
+	// only the resource of the same kind goes
+	c.deleteKubeObject(s, svc)
+	assert.Equal(t, []model.KubeResource{pod}, c.objects(s))
+
+	var actual []model.KubeResource
+	assert.NoError(t, c.Resources(&WatchFilter{Context: s, Namespace: "NS1", Kind: "Pod"}, &actual))
+	assert.Equal(t, []model.KubeResource{pod}, actual)
+	assert.NoError(t, c.Resources(&WatchFilter{Context: s, Namespace: "ns1", Kind: "service"}, &actual))
+	assert.Equal(t, []model.KubeResource{}, actual)
+}
+
+func TestResourcesSelectors(t *testing.T) {
+	c := NewWatchCache()
+	s := "s"
+	pod := func(name, app, node, phase string) model.KubeResource {
+		return model.KubeResource{
+			TypeMeta: model.TypeMeta{Kind: "pod"},
+			ResourceMeta: model.ResourceMeta{
+				Name:      name,
+				Namespace: "ns1",
+				Labels:    map[string]string{"app": app},
+				Fields:    map[string]string{"spec.nodeName": node, "status.phase": phase},
+			},
+		}
+	}
+	checkout1 := pod("checkout-1", "checkout", "node1", "Running")
+	checkout2 := pod("checkout-2", "checkout", "node2", "Pending")
+	cart := pod("cart-1", "cart", "node1", "Running")
+	for _, r := range []model.KubeResource{checkout1, checkout2, cart} {
+		c.updateKubeObject(s, r)
+	}
+
+	tests := []struct {
+		labels   string
+		fields   string
+		expected []model.KubeResource
+	}{
+		{expected: []model.KubeResource{cart, checkout1, checkout2}},
+		{labels: "app=checkout", expected: []model.KubeResource{checkout1, checkout2}},
+		{labels: "app in (cart,other)", expected: []model.KubeResource{cart}},
+		{fields: "spec.nodeName=node1", expected: []model.KubeResource{cart, checkout1}},
+		{labels: "app!=cart", fields: "status.phase=Running", expected: []model.KubeResource{checkout1}},
+		{fields: "metadata.name=cart-1", expected: []model.KubeResource{cart}},
+		{labels: "tier=cache", expected: []model.KubeResource{}},
+	}
+	for _, test := range tests {
+		var actual []model.KubeResource
+		f := &WatchFilter{Context: s, Kind: "pod", LabelSelector: test.labels, FieldSelector: test.fields}
+		assert.NoError(t, c.Resources(f, &actual))
+		assert.Equal(t, test.expected, actual, "labels %q, fields %q", test.labels, test.fields)
+	}
+
+	var actual []model.KubeResource
+	assert.Error(t, c.Resources(&WatchFilter{Context: s, Kind: "pod", LabelSelector: "app in ("}, &actual))
+	assert.Error(t, c.Resources(&WatchFilter{Context: s, Kind: "pod", FieldSelector: "spec.nodeName"}, &actual))
+}
+
+// A cache the size of a large cluster: 50 namespaces of 200 pods, 20 services and 20 deployments each
+func largeCache() *WatchCache {
+	c := NewWatchCache()
+	for n := 0; n < 50; n++ {
+		ns := fmt.Sprintf("ns%d", n)
+		for _, kind := range []string{"pod", "service", "deployment"} {
+			count := 20
+			if kind == "pod" {
+				count = 200
+			}
+			for i := 0; i < count; i++ {
+				c.updateKubeObject("ctx", model.KubeResource{
+					TypeMeta:     model.TypeMeta{Kind: kind},
+					ResourceMeta: model.ResourceMeta{Name: fmt.Sprintf("%s-%d", kind, i), Namespace: ns, Status: string(v1.PodRunning)},
+				})
+			}
+		}
+	}
+
+	return c
+}
+
+func BenchmarkUpdateKubeObject(b *testing.B) {
+	c := largeCache()
+	r := model.KubeResource{
+		TypeMeta:     model.TypeMeta{Kind: "pod"},
+		ResourceMeta: model.ResourceMeta{Name: "pod-100", Namespace: "ns25", Status: string(v1.PodPending)},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.updateKubeObject("ctx", r)
+	}
+}
+
+func BenchmarkDeleteKubeObject(b *testing.B) {
+	c := largeCache()
+	r := model.KubeResource{
+		TypeMeta:     model.TypeMeta{Kind: "pod"},
+		ResourceMeta: model.ResourceMeta{Name: "pod-100", Namespace: "ns25"},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.deleteKubeObject("ctx", r)
+		c.updateKubeObject("ctx", r)
+	}
+}
+
+func BenchmarkResourcesInNamespace(b *testing.B) {
+	c := largeCache()
+	f := &WatchFilter{Context: "ctx", Namespace: "ns25", Kind: "pod"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var kr []model.KubeResource
+		if err := c.Resources(f, &kr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResourcesAllNamespaces(b *testing.B) {
+	c := largeCache()
+	f := &WatchFilter{Context: "ctx", Kind: "service"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var kr []model.KubeResource
+		if err := c.Resources(f, &kr); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"autocli/model"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// The label and field selectors of a filter, which select everything if they're blank
+func parseSelectors(f *WatchFilter) (labels.Selector, fields.Selector, error) {
+	ls, err := labels.Parse(f.LabelSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid label selector %q: %s", f.LabelSelector, err)
+	}
+	fs, err := fields.ParseSelector(f.FieldSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid field selector %q: %s", f.FieldSelector, err)
+	}
+
+	return ls, fs, nil
+}
+
+// Whether the resource matches both selectors. Like kubectl, the name and namespace can always be selected on
+func selects(r model.KubeResource, ls labels.Selector, fs fields.Selector) bool {
+	if !ls.Matches(labels.Set(r.Labels)) {
+		return false
+	}
+	if fs.Empty() {
+		return true
+	}
+
+	set := fields.Set{
+		"metadata.name":      r.Name,
+		"metadata.namespace": r.Namespace,
+	}
+	for k, v := range r.Fields {
+		set[k] = v
+	}
+
+	return fs.Matches(set)
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"autocli/model"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The cache as written to disk, so a restarted watch server can serve suggestions straight away
+type cacheSnapshot struct {
+	SavedAt  time.Time
+	Contexts map[string]*contextSnapshot
+}
+
+type contextSnapshot struct {
+	// when the context was last saved, which is earlier than the snapshot's if no server has watched it since
+	SavedAt   time.Time
+	Resources []model.KubeResource
+	// the resourceVersion of the context's latest listing, which the informers resume from
+	ResourceVersion string
+}
+
+// how long a context no server watches is kept in the snapshot
+const snapshotMaxAge = 7 * 24 * time.Hour
+
+func defaultSnapshotPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "kubectl-ac", "snapshot.json")
+}
+
+// Take a copy of everything in the cache
+func (c *WatchCache) snapshot() *cacheSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	snap := &cacheSnapshot{
+		SavedAt:  now,
+		Contexts: make(map[string]*contextSnapshot),
+	}
+	for s, store := range c.resources {
+		snap.Contexts[s] = &contextSnapshot{
+			SavedAt:         now,
+			Resources:       store.list(),
+			ResourceVersion: c.resourceVersions[s],
+		}
+	}
+
+	return snap
+}
+
+// Load the specified contexts from a snapshot into the cache. Their kinds are marked as stale until
+// the informers have relisted them
+func (c *WatchCache) restore(snap *cacheSnapshot, contexts []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range contexts {
+		cs, ok := snap.Contexts[s]
+		if !ok {
+			continue
+		}
+
+		store := newResourceStore()
+		for _, r := range cs.Resources {
+			store.put(r)
+		}
+		c.resources[s] = store
+		if cs.ResourceVersion != "" {
+			c.resourceVersions[s] = cs.ResourceVersion
+		}
+		c.stale[s] = make(map[string]bool)
+		for _, r := range cs.Resources {
+			c.stale[s][keyOf(r).kind] = true
+		}
+		log.WithField("context", s).WithField("saved", cs.SavedAt).Infof("loaded %d resources from snapshot", len(cs.Resources))
+	}
+}
+
+func readSnapshot(path string) (*cacheSnapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &cacheSnapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// Write the snapshot, keeping any contexts in the existing file that this server doesn't watch unless they were last
+// saved too long ago. The file is only readable by the user as it lists what's running in their clusters
+func writeSnapshot(path string, snap *cacheSnapshot) error {
+	if existing, err := readSnapshot(path); err == nil {
+		for s, cs := range existing.Contexts {
+			if _, ok := snap.Contexts[s]; !ok && snap.SavedAt.Sub(cs.SavedAt) < snapshotMaxAge {
+				snap.Contexts[s] = cs
+			}
+		}
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a half written snapshot behind
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func warmStart(c *WatchCache, path string, contexts []string) {
+	snap, err := readSnapshot(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithField("path", path).WithField("error", err).Error("failed to read snapshot")
+		}
+		return
+	}
+
+	c.restore(snap, contexts)
+}
+
+func saveSnapshot(c *WatchCache, path string) {
+	if err := writeSnapshot(path, c.snapshot()); err != nil {
+		log.WithField("path", path).WithField("error", err).Error("failed to save snapshot")
+		return
+	}
+	log.WithField("path", path).Debug("saved snapshot")
+}
+
+// Save a snapshot every interval until the context is done. The returned channel is closed once the loop has
+// stopped, so a final snapshot can be saved without racing it
+func loopSnapshot(ctx context.Context, c *WatchCache, path string, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	save := func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+				saveSnapshot(c, path)
+			}
+		}
+	}
+
+	go save()
+
+	return done
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"autocli/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotWarmStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache", "snapshot.json")
+
+	pod := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "pod"}, ResourceMeta: model.ResourceMeta{Name: "p1", Namespace: "ns1", ResourceVersion: "10"}}
+	node := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "node"}, ResourceMeta: model.ResourceMeta{Name: "n1"}}
+	c := NewWatchCache()
+	c.updateKubeObject("ctx1", pod)
+	c.updateKubeObject("ctx2", node)
+	c.setResourceVersion("ctx1", "10")
+	assert.NoError(t, writeSnapshot(path, c.snapshot()))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// only the contexts being watched are loaded
+	restarted := NewWatchCache()
+	warmStart(restarted, path, []string{"ctx1"})
+	assert.Equal(t, []model.KubeResource{pod}, restarted.objects("ctx1"))
+	assert.Equal(t, "10", restarted.resourceVersion("ctx1"))
+	assert.True(t, restarted.stale["ctx1"]["pod"])
+	_, ok := restarted.resources["ctx2"]
+	assert.False(t, ok)
+
+	// the first full listing supersedes the snapshot
+	restarted.replaceKubeObjects("ctx1", "pod", []model.KubeResource{})
+	assert.False(t, restarted.stale["ctx1"]["pod"])
+
+	// contexts another watch server saved are kept
+	assert.NoError(t, writeSnapshot(path, restarted.snapshot()))
+	snap, err := readSnapshot(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.KubeResource{node}, snap.Contexts["ctx2"].Resources)
+	assert.Equal(t, 0, len(snap.Contexts["ctx1"].Resources))
+}
+
+func TestSnapshotDropsOldContexts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	node := model.KubeResource{TypeMeta: model.TypeMeta{Kind: "node"}, ResourceMeta: model.ResourceMeta{Name: "n1"}}
+	now := time.Now()
+	existing := &cacheSnapshot{
+		SavedAt: now,
+		Contexts: map[string]*contextSnapshot{
+			"recent": {SavedAt: now.Add(-time.Hour), Resources: []model.KubeResource{node}},
+			"old":    {SavedAt: now.Add(-snapshotMaxAge - time.Hour), Resources: []model.KubeResource{node}},
+			"ctx1":   {SavedAt: now.Add(-snapshotMaxAge - time.Hour), Resources: []model.KubeResource{node}},
+		},
+	}
+	assert.NoError(t, writeSnapshot(path, existing))
+
+	c := NewWatchCache()
+	c.replaceKubeObjects("ctx1", "node", []model.KubeResource{})
+	assert.NoError(t, writeSnapshot(path, c.snapshot()))
+
+	snap, err := readSnapshot(path)
+	if assert.NoError(t, err) {
+		assert.Contains(t, snap.Contexts, "recent")
+		assert.NotContains(t, snap.Contexts, "old")
+		// the context this server watches is saved afresh
+		assert.Empty(t, snap.Contexts["ctx1"].Resources)
+	}
+}
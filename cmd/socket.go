@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// the prefix of bind addresses that are Unix domain sockets rather than TCP host:port pairs
+const unixPrefix = "unix:"
+
+// The directory for the watch server's socket and runtime files: under $XDG_RUNTIME_DIR, which only the user
+// can get into, or failing that a directory of the user's own in the temp dir
+func runtimeDir() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("kubectl-ac-%d", os.Getuid()))
+	}
+
+	return filepath.Join(dir, "kubectl-ac")
+}
+
+func defaultSocketPath() string {
+	return filepath.Join(runtimeDir(), "watch.sock")
+}
+
+// Create a directory only the user can get into, or make sure an existing one is the user's and only theirs
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s isn't owned by the current user", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return os.Chmod(dir, 0700)
+	}
+
+	return nil
+}
+
+// Split a bind address into the network and the address to listen on or dial
+func splitBind(bind string) (string, string) {
+	if strings.HasPrefix(bind, unixPrefix) {
+		return "unix", strings.TrimPrefix(bind, unixPrefix)
+	}
+
+	return "tcp", bind
+}
+
+/*
+Listen on the bind address. A socket is created in a directory only the user can get into and is only readable
+and writable by the user, so other users on the host can't query the cache. A socket left behind by a server that
+didn't shut down cleanly is replaced, but one that's in use means a server is already running
+*/
+func listen(bind string) (net.Listener, error) {
+	network, address := splitBind(bind)
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	if err := privateDir(filepath.Dir(address)); err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(address); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", address)
+		}
+		if conn, err := net.Dial("unix", address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a watch server is already listening on %s", address)
+		}
+		if err := os.Remove(address); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(address, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Whether the error from dialling the watch server means it isn't running
+func isServerDown(err error) bool {
+	return strings.Contains(err.Error(), "connection refused") || strings.Contains(err.Error(), "no such file or directory")
+}
+
+// The flags that make a launched watch server listen on the bind address
+func bindArgs(bind string) []string {
+	network, address := splitBind(bind)
+	if network == "unix" {
+		return []string{"--socket", address}
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return []string{"--tcp"}
+	}
+
+	return []string{"--tcp", "--address", host, "--port", port}
+}
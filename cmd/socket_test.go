@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBind(t *testing.T) {
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		AddCommonFlags(cmd)
+		return cmd
+	}
+
+	cmd := newCmd()
+	bind, err := GetBind(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, "unix:/run/user/1000/kubectl-ac/watch.sock", bind)
+
+	cmd = newCmd()
+	cmd.Flags().Set("socket", "/tmp/ac.sock")
+	bind, _ = GetBind(cmd)
+	assert.Equal(t, "unix:/tmp/ac.sock", bind)
+
+	cmd = newCmd()
+	cmd.Flags().Set("tcp", "true")
+	bind, _ = GetBind(cmd)
+	assert.Equal(t, "127.0.0.1:33033", bind)
+
+	cmd = newCmd()
+	cmd.Flags().Set("port", "33055")
+	bind, _ = GetBind(cmd)
+	assert.Equal(t, "127.0.0.1:33055", bind)
+}
+
+func TestBindArgs(t *testing.T) {
+	assert.Equal(t, []string{"--socket", "/tmp/ac.sock"}, bindArgs("unix:/tmp/ac.sock"))
+	assert.Equal(t, []string{"--tcp", "--address", "127.0.0.1", "--port", "33033"}, bindArgs("127.0.0.1:33033"))
+}
+
+func TestListenSocket(t *testing.T) {
+	once.Do(setupRPC)
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "run", "watch.sock")
+	bind := unixPrefix + path
+
+	l, err := listen(bind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(l, nil)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	info, err = os.Stat(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	client, err := NewWatchClient(bind, "*cmd.DefaultBuilder", "/rpctest", TLSFiles{})
+	assert.NoError(t, err)
+	ct, err := client.Status("ctx1")
+	assert.NoError(t, err)
+	assert.Equal(t, 29, ct)
+
+	// only one server can listen on the socket
+	_, err = listen(bind)
+	assert.Error(t, err)
+	l.Close()
+
+	// a socket left behind by a server that died is replaced
+	stale, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	l, err = listen(bind)
+	assert.NoError(t, err)
+	l.Close()
+
+	_, err = NewWatchClient(bind, "*cmd.DefaultBuilder", "/rpctest", TLSFiles{})
+	assert.True(t, isServerDown(err))
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// What a running watch server records about itself, so it can be found, stopped and restarted
+type serverState struct {
+	PID       int
+	Address   string
+	Version   string
+	StartedAt time.Time
+	Contexts  []string
+	// the flags the server was started with, so it can be restarted the same way
+	Flags []string
+	// $KUBECONFIG when the server was started, which it loads kubeconfig from unless --kubeconfig was given
+	KubeConfig string `json:",omitempty"`
+}
+
+func statePath() string {
+	return filepath.Join(runtimeDir(), "state.json")
+}
+
+func readState(path string) (*serverState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &serverState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Write the state to a file only the user can read, next to the socket and token
+func writeState(path string, state *serverState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	if err := privateDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Remove the state file, as long as it's still the one written by the process with the PID
+func removeState(path string, pid int) {
+	state, err := readState(path)
+	if err != nil || state.PID != pid {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.WithField("path", path).WithField("error", err).Error("failed to remove state file")
+	}
+}
+
+// Whether a process with the PID exists
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+// Point the runtime dir, where the state file goes, at a temporary directory
+func tempRuntimeDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Getenv("XDG_RUNTIME_DIR")
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+
+	return func() {
+		os.Setenv("XDG_RUNTIME_DIR", old)
+		os.RemoveAll(dir)
+	}
+}
+
+// The PID of a process that has exited
+func deadPID(t *testing.T) int {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd.Process.Pid
+}
+
+func TestStateFile(t *testing.T) {
+	defer tempRuntimeDir(t)()
+
+	state := &serverState{PID: 42, Address: "unix:/run/watch.sock", Version: "dev", Contexts: []string{"dev", "prod"}, Flags: []string{"--syslog=true"}}
+	assert.NoError(t, writeState(statePath(), state))
+	info, err := os.Stat(statePath())
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	read, err := readState(statePath())
+	assert.NoError(t, err)
+	assert.Equal(t, state, read)
+
+	// only the server that wrote the state file removes it
+	removeState(statePath(), 43)
+	_, err = os.Stat(statePath())
+	assert.NoError(t, err)
+	removeState(statePath(), 42)
+	_, err = os.Stat(statePath())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestProcessAlive(t *testing.T) {
+	assert.True(t, processAlive(os.Getpid()))
+	assert.False(t, processAlive(deadPID(t)))
+	assert.False(t, processAlive(0))
+}
+
+func TestStopStaleServer(t *testing.T) {
+	defer tempRuntimeDir(t)()
+	b := NewTestBuilder()
+
+	_, err := stopServer(b, TLSFiles{})
+	assert.Equal(t, errNotRunning, err)
+
+	// a state file left behind by a server that died is removed, and nothing is signalled
+	pid := deadPID(t)
+	sock := filepath.Join(runtimeDir(), "watch.sock")
+	assert.NoError(t, writeState(statePath(), &serverState{PID: pid, Address: unixPrefix + sock, Contexts: []string{"dev"}}))
+	state, err := stopServer(b, TLSFiles{})
+	assert.Equal(t, errNotRunning, err)
+	assert.Equal(t, []string{"dev"}, state.Contexts)
+	_, err = os.Stat(statePath())
+	assert.True(t, os.IsNotExist(err))
+
+	// a live process that isn't the server isn't signalled either
+	assert.NoError(t, writeState(statePath(), &serverState{PID: os.Getpid(), Address: unixPrefix + sock}))
+	_, err = stopServer(b, TLSFiles{})
+	assert.Equal(t, errNotRunning, err)
+}
+
+func TestServerAddress(t *testing.T) {
+	defer tempRuntimeDir(t)()
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		AddCommonFlags(cmd)
+		return cmd
+	}
+
+	address, err := serverAddress(newCmd())
+	assert.NoError(t, err)
+	assert.Equal(t, unixPrefix+defaultSocketPath(), address)
+
+	assert.NoError(t, writeState(statePath(), &serverState{PID: 1, Address: "127.0.0.1:33055"}))
+	address, _ = serverAddress(newCmd())
+	assert.Equal(t, "127.0.0.1:33055", address)
+
+	// flags on the command line win
+	cmd := newCmd()
+	cmd.Flags().Set("port", "33066")
+	address, _ = serverAddress(cmd)
+	assert.Equal(t, "127.0.0.1:33066", address)
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// What the watch of a kind is currently doing
+type WatchState string
+
+const (
+	// listing the kind before watching it
+	Syncing WatchState = "syncing"
+	// listed and receiving events (or, for polled kinds, the last poll succeeded)
+	Watching WatchState = "watching"
+	// the last attempt failed and it'll be retried
+	BackingOff WatchState = "backing off"
+	// the kind can't be watched and won't be retried
+	Failed WatchState = "failed"
+)
+
+type kindState struct {
+	state     WatchState
+	lastSync  time.Time
+	lastError string
+}
+
+// Moving to Watching records the time of the sync and any error is kept as the last error until another one comes along
+func (ks *kindState) set(state WatchState, err error) {
+	ks.state = state
+	if state == Watching {
+		ks.lastSync = time.Now()
+	}
+	if err != nil {
+		ks.lastError = err.Error()
+	}
+}
+
+type ServerStatus struct {
+	PID       int
+	Version   string
+	StartedAt time.Time
+	Uptime    string
+	Contexts  []ContextStatus
+}
+
+type ContextStatus struct {
+	Name string
+	// whether the context's server has been reached, its watches only start once it has
+	State     WatchState
+	LastError string
+	Objects   int
+	// when a client last asked for the context's resources, zero if none has
+	LastQueried time.Time
+	Kinds       []KindStatus
+}
+
+type KindStatus struct {
+	Kind      string
+	State     WatchState
+	LastSync  time.Time
+	LastError string
+	Objects   int
+	// the objects were loaded from the snapshot and haven't been listed from the cluster since
+	Stale bool
+}
+
+// Record what the watch of a kind is doing
+func (c *WatchCache) setWatchState(s, kind string, state WatchState, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	states, ok := c.watchStates[s]
+	if !ok {
+		states = make(map[string]*kindState)
+		c.watchStates[s] = states
+	}
+	ks, ok := states[kind]
+	if !ok {
+		ks = &kindState{}
+		states[kind] = ks
+	}
+
+	ks.set(state, err)
+}
+
+// Record whether the context's server has been reached
+func (c *WatchCache) setContextState(s string, state WatchState, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cs, ok := c.contextStates[s]
+	if !ok {
+		cs = &kindState{}
+		c.contextStates[s] = cs
+	}
+
+	cs.set(state, err)
+}
+
+// The status of a context, from the kinds being watched and those held in the cache. The caller must hold the lock
+func (c *WatchCache) contextStatus(s string) ContextStatus {
+	cs := ContextStatus{Name: s, LastQueried: c.lastQueriedTime(s), Kinds: []KindStatus{}}
+	if state, ok := c.contextStates[s]; ok {
+		cs.State = state.state
+		cs.LastError = state.lastError
+	}
+	kinds := make(map[string]*KindStatus)
+
+	for kind, ks := range c.watchStates[s] {
+		kinds[strings.ToLower(kind)] = &KindStatus{
+			Kind:      kind,
+			State:     ks.state,
+			LastSync:  ks.lastSync,
+			LastError: ks.lastError,
+		}
+	}
+	if store, ok := c.resources[s]; ok {
+		cs.Objects = store.len()
+		for kind, keys := range store.byKind {
+			if _, ok := kinds[kind]; !ok {
+				kinds[kind] = &KindStatus{Kind: kind}
+			}
+			kinds[kind].Objects = len(keys)
+		}
+	}
+	for kind := range c.stale[s] {
+		if ks, ok := kinds[strings.ToLower(kind)]; ok {
+			ks.Stale = true
+		}
+	}
+
+	for _, ks := range kinds {
+		cs.Kinds = append(cs.Kinds, *ks)
+	}
+	sort.Slice(cs.Kinds, func(i, j int) bool {
+		return cs.Kinds[i].Kind < cs.Kinds[j].Kind
+	})
+
+	return cs
+}
+
+func NewStatusCommand(b Builder) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "status [flags] [context]",
+		Short: "Show the state of the watch server and of the watches for each context",
+		Long: `
+DESCRIPTION
+	Show the version and uptime of the running watch server and, for each context it watches
+	(or just the specified one), the state of the watch of each kind, when it last synced
+	with the cluster, the last error and how many objects are cached.
+`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := RunCommon(cmd); err != nil {
+				return err
+			}
+			return RunStatus(b, cmd, args)
+		},
+	}
+
+	AddCommonFlags(cmd)
+	cmd.Flags().StringP("output", "o", "table", "Output format, table or json")
+
+	return cmd
+}
+
+func RunStatus(b Builder, cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if output != "table" && output != "json" {
+		return fmt.Errorf("unsupported output format: %s", output)
+	}
+
+	context := ""
+	if len(args) == 1 {
+		context = args[0]
+	}
+
+	bind, err := serverAddress(cmd)
+	if err != nil {
+		return fmt.Errorf("unexpected error: %s", err)
+	}
+
+	tf, err := GetTLSFiles(cmd)
+	if err != nil {
+		return err
+	}
+
+	// don't launch the watch server just to report on it
+	client, err := NewWatchClient(bind, reflect.TypeOf(b).String(), "", tf)
+	if err != nil {
+		if isServerDown(err) {
+			return errNotRunning
+		}
+		return err
+	}
+
+	status, err := client.ServerStatus(context)
+	if err != nil {
+		return err
+	}
+	log.WithField("status", status).Debug("received status")
+
+	if output == "json" {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(b.StdOut(), string(data))
+		return nil
+	}
+
+	printStatus(b, status, time.Now())
+	return nil
+}
+
+func printStatus(b Builder, status *ServerStatus, now time.Time) {
+	fmt.Fprintf(b.StdOut(), "PID: %d\n", status.PID)
+	fmt.Fprintf(b.StdOut(), "Version: %s\n", status.Version)
+	fmt.Fprintf(b.StdOut(), "Uptime: %s\n\n", status.Uptime)
+
+	w := tabwriter.NewWriter(b.StdOut(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTEXT\tKIND\tSTATE\tOBJECTS\tLAST SYNC\tLAST ERROR")
+	for _, cs := range status.Contexts {
+		// until the server has been reached there are no watches to show, just why it hasn't been
+		if cs.State != "" && cs.State != Watching {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", cs.Name, "-", cs.State, cs.Objects, "never", cs.LastError)
+		}
+		for _, ks := range cs.Kinds {
+			state := string(ks.State)
+			if state == "" {
+				state = "-"
+			}
+			if ks.Stale {
+				state += " (from snapshot)"
+			}
+			lastSync := "never"
+			if !ks.LastSync.IsZero() {
+				lastSync = fmt.Sprintf("%s ago", now.Sub(ks.LastSync).Round(time.Second))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", cs.Name, ks.Kind, state, ks.Objects, lastSync, ks.LastError)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"autocli/model"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestServerStatus(t *testing.T) {
+	c := NewWatchCache()
+	c.updateKubeObject("ctx1", model.KubeResource{TypeMeta: model.TypeMeta{Kind: "pod"}, ResourceMeta: model.ResourceMeta{Name: "p1", Namespace: "ns1"}})
+	c.updateKubeObject("ctx1", model.KubeResource{TypeMeta: model.TypeMeta{Kind: "pod"}, ResourceMeta: model.ResourceMeta{Name: "p2", Namespace: "ns1"}})
+	c.setWatchState("ctx1", "pod", Syncing, nil)
+	c.setWatchState("ctx1", "pod", BackingOff, errors.New("connection refused"))
+	c.setWatchState("ctx1", "pod", Watching, nil)
+	c.setWatchState("ctx1", "certs", Failed, errors.New("the server doesn't have a resource type"))
+	c.stale["ctx1"] = map[string]bool{"pod": true}
+	c.setWatchState("ctx2", "node", Syncing, nil)
+
+	var status ServerStatus
+	ctx := ""
+	assert.NoError(t, c.ServerStatus(&ctx, &status))
+	assert.Equal(t, BuildVersion, status.Version)
+	assert.Equal(t, 2, len(status.Contexts))
+
+	ctx1 := status.Contexts[0]
+	assert.Equal(t, "ctx1", ctx1.Name)
+	assert.Equal(t, 2, ctx1.Objects)
+	assert.Equal(t, "certs", ctx1.Kinds[0].Kind)
+	assert.Equal(t, Failed, ctx1.Kinds[0].State)
+	pod := ctx1.Kinds[1]
+	assert.Equal(t, Watching, pod.State)
+	assert.Equal(t, 2, pod.Objects)
+	assert.Equal(t, "connection refused", pod.LastError)
+	assert.False(t, pod.LastSync.IsZero())
+	assert.True(t, pod.Stale)
+
+	ctx = "ctx2"
+	assert.NoError(t, c.ServerStatus(&ctx, &status))
+	assert.Equal(t, 1, len(status.Contexts))
+	assert.Equal(t, Syncing, status.Contexts[0].Kinds[0].State)
+	assert.True(t, status.Contexts[0].Kinds[0].LastSync.IsZero())
+
+	ctx = "other"
+	assert.Error(t, c.ServerStatus(&ctx, &status))
+
+	// removing a context forgets its states
+	c.removeContext("ctx2")
+	ctx = "ctx2"
+	assert.Error(t, c.ServerStatus(&ctx, &status))
+}
+
+func TestPrintStatus(t *testing.T) {
+	out := &bytes.Buffer{}
+	b := &DefaultBuilder{Streams: genericclioptions.IOStreams{Out: out}}
+	now := time.Now()
+	status := &ServerStatus{
+		PID:     42,
+		Version: "1.0",
+		Uptime:  "1h0m0s",
+		Contexts: []ContextStatus{{
+			Name:    "ctx1",
+			State:   Watching,
+			Objects: 3,
+			Kinds: []KindStatus{
+				{Kind: "node", State: BackingOff, LastError: "timeout"},
+				{Kind: "pod", State: Watching, LastSync: now.Add(-90 * time.Second), Objects: 3, Stale: true},
+			},
+		}, {
+			Name:      "vpn",
+			State:     BackingOff,
+			LastError: "failed to ping server: timeout",
+			Kinds:     []KindStatus{},
+		}},
+	}
+
+	printStatus(b, status, now)
+	expected := `PID: 42
+Version: 1.0
+Uptime: 1h0m0s
+
+CONTEXT  KIND  STATE                     OBJECTS  LAST SYNC  LAST ERROR
+ctx1     node  backing off               0        never      timeout
+ctx1     pod   watching (from snapshot)  3        1m30s ago  
+vpn      -     backing off               0        never      failed to ping server: timeout
+`
+	assert.Equal(t, expected, out.String())
+}
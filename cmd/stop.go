@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// how long to wait for the watch server to exit once it's been told to stop
+const stopTimeout = 10 * time.Second
+
+var errNotRunning = errors.New("the watch server isn't running")
+
+func NewStopCommand(b Builder) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "stop [flags]",
+		Short: "Stop the watch server",
+		Long: `
+DESCRIPTION
+	Stop the watch server recorded in the state file. Only the watch server is stopped,
+	any other kubectl-ac processes, e.g. prompts, are left alone.
+`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := RunCommon(cmd); err != nil {
+				return err
+			}
+			return RunStop(b, cmd, args)
+		},
+	}
+
+	AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func RunStop(b Builder, cmd *cobra.Command, args []string) error {
+	tf, err := GetTLSFiles(cmd)
+	if err != nil {
+		return err
+	}
+
+	state, err := stopServer(b, tf)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b.StdOut(), "watch server (PID %d) stopped\n", state.PID)
+
+	return nil
+}
+
+// The address of the watch server: the one in the state file unless one was given on the command line
+func serverAddress(cmd *cobra.Command) (string, error) {
+	for _, f := range []string{"address", "port", "tcp", "socket", "tls-cert", "tls-ca"} {
+		if cmd.Flags().Changed(f) {
+			return GetBind(cmd)
+		}
+	}
+	if state, err := readState(statePath()); err == nil {
+		return state.Address, nil
+	}
+
+	return GetBind(cmd)
+}
+
+/*
+Stop the watch server in the state file and wait for it to exit; the state it was running with is returned.
+The server is asked to shut down through RPC and only signalled if that fails. Either is only done once the
+server has confirmed its PID, so a PID that's been reused by another process after the server died is never
+touched - a state file like that is just removed
+*/
+func stopServer(b Builder, tf TLSFiles) (*serverState, error) {
+	path := statePath()
+	state, err := readState(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errNotRunning
+		}
+		return nil, err
+	}
+
+	client := confirmedClient(b, state, tf)
+	if client == nil {
+		log.WithField("pid", state.PID).Debug("removing stale state file")
+		removeState(path, state.PID)
+		return state, errNotRunning
+	}
+
+	if err := client.Shutdown(); err != nil {
+		log.WithField("error", err).Debug("failed to shut down the watch server through RPC, signalling it")
+		if err := syscall.Kill(state.PID, syscall.SIGTERM); err != nil {
+			return state, fmt.Errorf("failed to stop the watch server (PID %d): %s", state.PID, err)
+		}
+	}
+	deadline := time.Now().Add(stopTimeout)
+	for processAlive(state.PID) {
+		if time.Now().After(deadline) {
+			return state, fmt.Errorf("the watch server (PID %d) hasn't stopped after %s", state.PID, stopTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// the server may not have had the chance to clean up after itself
+	removeState(path, state.PID)
+	if network, address := splitBind(state.Address); network == "unix" {
+		os.Remove(address)
+	}
+
+	return state, nil
+}
+
+// A client of the server at the address in the state file, as long as it's running with the PID in it, otherwise nil
+func confirmedClient(b Builder, state *serverState, tf TLSFiles) WatchClient {
+	if !processAlive(state.PID) {
+		return nil
+	}
+	client, err := NewWatchClient(state.Address, reflect.TypeOf(b).String(), "", tf)
+	if err != nil {
+		return nil
+	}
+	status, err := client.ServerStatus("")
+	if err != nil || status.PID != state.PID {
+		return nil
+	}
+
+	return client
+}
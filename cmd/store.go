@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"autocli/model"
+	"sort"
+	"strings"
+)
+
+// Identifies a resource within a context. Kind and namespace are lower case as clients look them up case-insensitively.
+// The kind is qualified by its group, so kinds of different groups with the same name are held apart
+type resourceKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func keyOf(r model.KubeResource) resourceKey {
+	return resourceKey{
+		kind:      strings.ToLower(r.QualifiedKind()),
+		namespace: strings.ToLower(r.Namespace),
+		name:      r.Name,
+	}
+}
+
+type keySet map[resourceKey]struct{}
+
+// The resources of a single context, with secondary indexes on kind and on kind + namespace so that applying
+// an event or answering a query only touches the resources involved rather than everything in the context
+type resourceStore struct {
+	objects map[resourceKey]model.KubeResource
+	byKind  map[string]keySet
+	// kind -> namespace -> keys; cluster scoped resources are held under the "" namespace
+	byNamespace map[string]map[string]keySet
+}
+
+func newResourceStore() *resourceStore {
+	return &resourceStore{
+		objects:     make(map[resourceKey]model.KubeResource),
+		byKind:      make(map[string]keySet),
+		byNamespace: make(map[string]map[string]keySet),
+	}
+}
+
+func (s *resourceStore) put(r model.KubeResource) {
+	k := keyOf(r)
+	s.objects[k] = r
+
+	if _, ok := s.byKind[k.kind]; !ok {
+		s.byKind[k.kind] = make(keySet)
+	}
+	s.byKind[k.kind][k] = struct{}{}
+
+	namespaces, ok := s.byNamespace[k.kind]
+	if !ok {
+		namespaces = make(map[string]keySet)
+		s.byNamespace[k.kind] = namespaces
+	}
+	if _, ok := namespaces[k.namespace]; !ok {
+		namespaces[k.namespace] = make(keySet)
+	}
+	namespaces[k.namespace][k] = struct{}{}
+}
+
+func (s *resourceStore) remove(k resourceKey) {
+	if _, ok := s.objects[k]; !ok {
+		return
+	}
+	delete(s.objects, k)
+
+	delete(s.byKind[k.kind], k)
+	if len(s.byKind[k.kind]) == 0 {
+		delete(s.byKind, k.kind)
+	}
+
+	namespaces := s.byNamespace[k.kind]
+	delete(namespaces[k.namespace], k)
+	if len(namespaces[k.namespace]) == 0 {
+		delete(namespaces, k.namespace)
+	}
+	if len(namespaces) == 0 {
+		delete(s.byNamespace, k.kind)
+	}
+}
+
+func (s *resourceStore) removeKind(kind string) {
+	kind = strings.ToLower(kind)
+	for k := range s.byKind[kind] {
+		delete(s.objects, k)
+	}
+	delete(s.byKind, kind)
+	delete(s.byNamespace, kind)
+}
+
+func (s *resourceStore) len() int {
+	return len(s.objects)
+}
+
+// All the resources in the store, sorted by kind, namespace and name
+func (s *resourceStore) list() []model.KubeResource {
+	res := make([]model.KubeResource, 0, len(s.objects))
+	for _, r := range s.objects {
+		res = append(res, r)
+	}
+	sort.Sort(model.ByKindNSName(res))
+
+	return res
+}
+
+// The resources of a kind, sorted by namespace and name. If a namespace is given only the resources in it are
+// returned, along with any cluster scoped ones (nodes, namespaces etc.) which don't have a namespace to filter on
+func (s *resourceStore) query(kind, namespace string) []model.KubeResource {
+	kind = strings.ToLower(kind)
+	res := []model.KubeResource{}
+
+	if namespace == "" {
+		for k := range s.byKind[kind] {
+			res = append(res, s.objects[k])
+		}
+	} else {
+		for _, ns := range []string{"", strings.ToLower(namespace)} {
+			for k := range s.byNamespace[kind][ns] {
+				res = append(res, s.objects[k])
+			}
+		}
+	}
+	sort.Sort(model.ByKindNSName(res))
+
+	return res
+}
@@ -8,6 +8,8 @@ import (
 	log "github.com/sirupsen/logrus"
 	"io"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	testclient "k8s.io/client-go/kubernetes/fake"
 	"net"
@@ -52,7 +54,7 @@ func (t *TestBuilder) PopulateContextSuggestions(source map[string][][]string) {
 	panic("implement me")
 }
 
-func (t *TestBuilder) KubeClient(clients map[string]kubernetes.Interface) service.KubeClient {
+func (t *TestBuilder) KubeClient(clients map[string]kubernetes.Interface, dynamicClients map[string]dynamic.Interface) service.KubeClient {
 	testClients := map[string]kubernetes.Interface{}
 	for key := range clients {
 		testClients[key] = testclient.NewSimpleClientset()
@@ -61,6 +63,10 @@ func (t *TestBuilder) KubeClient(clients map[string]kubernetes.Interface) servic
 		clients:         testClients,
 		watchObjectLock: &sync.RWMutex{},
 		watchObjectHits: map[string]int{},
+		stopChs:         map[string]chan struct{}{},
+		unreachable:     map[string]bool{},
+		namespaces:      map[string]service.Namespaces{},
+		resumeFrom:      map[string]string{},
 	}
 
 	return t.testKubeClient
@@ -70,17 +76,20 @@ func (t *TestBuilder) WatchCache() *WatchCache {
 	return NewWatchCache()
 }
 
-func (t *TestBuilder) WatchClient(address, logLvlArg, kubeConfigArg, kubeCtxArg string) (WatchClient, error) {
-	return NewWatchClient(address, reflect.TypeOf(t).String(), "")
+func (t *TestBuilder) WatchClient(address, logLvlArg, kubeConfigArg, kubeCtxArg string, tf TLSFiles) (WatchClient, error) {
+	return NewWatchClient(address, reflect.TypeOf(t).String(), "", tf)
 }
 
-func (t *TestBuilder) Serve(l net.Listener, c *WatchCache) error {
+func (t *TestBuilder) Serve(l net.Listener, c *WatchCache, token string) error {
 
 	fmt.Println("in TestBuilder.Serve" + reflect.TypeOf(t).String())
-	rpc.RegisterName(reflect.TypeOf(t).String(), c)
-	rpc.HandleHTTP()
+	// a server of its own, so tests can start more than one watch server
+	server := rpc.NewServer()
+	server.RegisterName(reflect.TypeOf(t).String(), c)
+	mux := http.NewServeMux()
+	mux.Handle(rpc.DefaultRPCPath, server)
 
-	return http.Serve(l, nil)
+	return http.Serve(l, requireToken(token, mux))
 
 }
 
@@ -92,9 +101,16 @@ type TestKubeClient struct {
 	clients         map[string]kubernetes.Interface
 	watchObjectHits map[string]int
 	watchObjectLock *sync.RWMutex
+	// closed when the context is removed, like the informers of the real client
+	stopChs map[string]chan struct{}
+	// contexts whose server can't be reached
+	unreachable map[string]bool
+	namespaces  map[string]service.Namespaces
+	resumeFrom  map[string]string
 }
 
-func (t TestKubeClient) GetResources(context, kind string) ([]model.KubeResource, error) {
+// The nodes and namespaces of a context, which WatchResources lists all at once
+func (t TestKubeClient) listed(context, kind string) ([]model.KubeResource, error) {
 	var resources []model.KubeResource
 
 	if context == "prod" {
@@ -102,6 +118,8 @@ func (t TestKubeClient) GetResources(context, kind string) ([]model.KubeResource
 		case "node":
 			service.AddToKubeResources(&resources, "node", "prodnode1", "", "", "Ready")
 			service.AddToKubeResources(&resources, "node", "prodnode2", "", "", "NotReady")
+		case "namespace":
+			service.AddToKubeResources(&resources, "namespace", "ns1", "", "", "Active")
 
 		}
 	} else if context == "dev" {
@@ -109,6 +127,9 @@ func (t TestKubeClient) GetResources(context, kind string) ([]model.KubeResource
 		case "node":
 			service.AddToKubeResources(&resources, "node", "devnode1", "", "", "Ready")
 			service.AddToKubeResources(&resources, "node", "devnode2", "", "", "NotReady")
+		case "namespace":
+			service.AddToKubeResources(&resources, "namespace", "ns1", "", "", "Active")
+			service.AddToKubeResources(&resources, "namespace", "ns2", "", "", "Active")
 
 		}
 	} else {
@@ -118,18 +139,73 @@ func (t TestKubeClient) GetResources(context, kind string) ([]model.KubeResource
 	return resources, nil
 }
 
+func (t TestKubeClient) ResolveKind(context, name string) (model.ResourceType, error) {
+	rt := model.ResourceType{
+		Kind:       "certificate",
+		Group:      "cert-manager.io",
+		Version:    "v1",
+		Resource:   "certificates",
+		ShortNames: []string{"cert"},
+		Namespaced: true,
+	}
+	if Contains(rt.Aliases(), name) {
+		return rt, nil
+	}
+
+	return model.ResourceType{}, fmt.Errorf("unknown resource: %s", name)
+}
+
 func (t TestKubeClient) Ping(context string) error {
+	t.watchObjectLock.RLock()
+	defer t.watchObjectLock.RUnlock()
+	if t.unreachable[context] {
+		return fmt.Errorf("dial tcp: connect: connection refused")
+	}
 	return nil
 }
 
+func (t TestKubeClient) SetNamespaces(context string, namespaces service.Namespaces) {
+	t.watchObjectLock.Lock()
+	defer t.watchObjectLock.Unlock()
+	t.namespaces[context] = namespaces
+}
+
+func (t TestKubeClient) ResumeFrom(context, resourceVersion string) {
+	t.watchObjectLock.Lock()
+	defer t.watchObjectLock.Unlock()
+	t.resumeFrom[context] = resourceVersion
+}
+
+func (t TestKubeClient) setReachable(context string, reachable bool) {
+	t.watchObjectLock.Lock()
+	defer t.watchObjectLock.Unlock()
+	t.unreachable[context] = !reachable
+}
+
 func (t TestKubeClient) WatchResources(context, kind string, out chan *model.ResourceEvent) error {
 	log.Debug("in WatchResources")
 	t.watchObjectLock.Lock()
 	t.watchObjectHits[kind] += 1
+	stopCh, ok := t.stopChs[context]
 	t.watchObjectLock.Unlock()
+	if !ok {
+		return fmt.Errorf("context not found: %s", context)
+	}
 
 	var evt model.ResourceEvent
 
+	// nodes and namespaces are listed all at once, the way an informer replaces what's cached
+	if kind == "node" || kind == "namespace" {
+		evt.Type = model.Replaced
+		evt.Resources, _ = t.listed(context, kind)
+		evt.ResourceVersion = "100"
+		select {
+		case out <- &evt:
+		case <-stopCh:
+		}
+		return nil
+	}
+
 	var podname, nsname string
 	if context == "prod" {
 		podname = "ns1-pod"
@@ -138,16 +214,43 @@ func (t TestKubeClient) WatchResources(context, kind string, out chan *model.Res
 		podname = "ns2-pod"
 		nsname = "ns2"
 	}
+	tm := model.TypeMeta{Kind: kind}
+	// resources found through discovery are watched as their kind qualified by its group
+	if rt, err := t.ResolveKind(context, kind); err == nil {
+		tm = model.TypeMeta{Kind: rt.Kind, Group: rt.Group, Version: rt.Version}
+	}
 	evt.Type = model.Added
 	evt.Resource = &model.KubeResource{
-		TypeMeta: model.TypeMeta{Kind: "pod"},
+		TypeMeta: tm,
 		ResourceMeta: model.ResourceMeta{
 			Name:      podname,
 			Namespace: nsname,
 			Status:    "Running",
 		},
 	}
-	out <- &evt
+	select {
+	case out <- &evt:
+	case <-stopCh:
+	}
 
 	return nil
 }
+
+func (t TestKubeClient) AddContext(context string, client kubernetes.Interface, dynamicClient dynamic.Interface, discoveryClient discovery.DiscoveryInterface) {
+	t.watchObjectLock.Lock()
+	defer t.watchObjectLock.Unlock()
+	if _, ok := t.clients[context]; !ok {
+		t.clients[context] = testclient.NewSimpleClientset()
+		t.stopChs[context] = make(chan struct{})
+	}
+}
+
+func (t TestKubeClient) RemoveContext(context string) {
+	t.watchObjectLock.Lock()
+	defer t.watchObjectLock.Unlock()
+	if stopCh, ok := t.stopChs[context]; ok {
+		close(stopCh)
+		delete(t.stopChs, context)
+	}
+	delete(t.clients, context)
+}
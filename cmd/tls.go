@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/spf13/cobra"
+)
+
+// The files for serving, or connecting to, the watch server over TLS, and the token file for TCP
+type TLSFiles struct {
+	// the CA the server verifies client certificates with, or the client verifies the server's certificate with
+	CA string
+	// the server's certificate, or the certificate a client presents to the server
+	Cert string
+	Key  string
+	// the file holding the token clients present to the server, blank for the one in the runtime dir
+	Token string
+}
+
+func GetTLSFiles(cmd *cobra.Command) (TLSFiles, error) {
+	var tf TLSFiles
+	var err error
+	if tf.CA, err = cmd.Flags().GetString("tls-ca"); err != nil {
+		return tf, err
+	}
+	if tf.Cert, err = cmd.Flags().GetString("tls-cert"); err != nil {
+		return tf, err
+	}
+	if tf.Key, err = cmd.Flags().GetString("tls-key"); err != nil {
+		return tf, err
+	}
+	if tf.Token, err = cmd.Flags().GetString("token-file"); err != nil {
+		return tf, err
+	}
+	if (tf.Cert == "") != (tf.Key == "") {
+		return tf, errors.New("--tls-cert and --tls-key have to be given together")
+	}
+
+	return tf, nil
+}
+
+func (tf TLSFiles) enabled() bool {
+	return tf.CA != "" || tf.Cert != ""
+}
+
+func (tf TLSFiles) tokenFile() string {
+	if tf.Token == "" {
+		return tokenPath()
+	}
+
+	return tf.Token
+}
+
+// Serve with the server's certificate and, if a CA is given, only accept clients with a certificate it signed (mTLS)
+func serverTLSConfig(tf TLSFiles) (*tls.Config, error) {
+	if tf.Cert == "" {
+		return nil, errors.New("serving over TLS needs --tls-cert and --tls-key")
+	}
+	cert, err := tls.LoadX509KeyPair(tf.Cert, tf.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %s", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if tf.CA != "" {
+		pool, err := loadCertPool(tf.CA)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// Verify the server's certificate with the CA (the system's CAs if none is given) and present the client's
+// certificate if one is given
+func clientTLSConfig(tf TLSFiles) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if tf.CA != "" {
+		pool, err := loadCertPool(tf.CA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if tf.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(tf.Cert, tf.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
+
+// Whether a TCP bind address is only reachable from this host
+func isLoopback(bind string) bool {
+	host, _, err := net.SplitHostPort(bind)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Generate a certificate signed by the parent (self-signed if there's none) and write it and its key to dir
+func writeCert(t *testing.T, dir, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+// A CA along with a server and a client certificate it signed
+func writeCerts(t *testing.T, dir string) {
+	notAfter := time.Now().Add(time.Hour)
+	ca, caKey := writeCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubectl-ac test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	writeCert(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "watch server"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     notAfter,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeCert(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "team member"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+}
+
+func TestMutualTLS(t *testing.T) {
+	once.Do(setupRPC)
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeCerts(t, dir)
+	file := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	serverConfig, err := serverTLSConfig(TLSFiles{CA: file("ca.pem"), Cert: file("server.pem"), Key: file("server-key.pem")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(tls.NewListener(l, serverConfig), rpc.DefaultServer)
+	address := l.Addr().String()
+
+	client, err := NewWatchClient(address, "*cmd.DefaultBuilder", "", TLSFiles{CA: file("ca.pem"), Cert: file("client.pem"), Key: file("client-key.pem")})
+	if !assert.NoError(t, err) {
+		return
+	}
+	ct, err := client.Status("ctx1")
+	assert.NoError(t, err)
+	assert.Equal(t, 29, ct)
+
+	// a client without a certificate is turned away
+	_, err = NewWatchClient(address, "*cmd.DefaultBuilder", "", TLSFiles{CA: file("ca.pem")})
+	assert.Error(t, err)
+
+	// as is a client that doesn't trust the server's CA
+	_, err = NewWatchClient(address, "*cmd.DefaultBuilder", "", TLSFiles{CA: file("client.pem"), Cert: file("client.pem"), Key: file("client-key.pem")})
+	assert.Error(t, err)
+
+	// or doesn't use TLS at all
+	_, err = NewWatchClient(address, "*cmd.DefaultBuilder", "", TLSFiles{})
+	assert.Error(t, err)
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeCerts(t, dir)
+
+	config, err := serverTLSConfig(TLSFiles{Cert: filepath.Join(dir, "server.pem"), Key: filepath.Join(dir, "server-key.pem")})
+	assert.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	_, err = serverTLSConfig(TLSFiles{CA: filepath.Join(dir, "ca.pem")})
+	assert.Error(t, err)
+	_, err = serverTLSConfig(TLSFiles{Cert: filepath.Join(dir, "missing.pem"), Key: filepath.Join(dir, "server-key.pem")})
+	assert.Error(t, err)
+}
+
+func TestIsLoopback(t *testing.T) {
+	assert.True(t, isLoopback("127.0.0.1:33033"))
+	assert.True(t, isLoopback("localhost:33033"))
+	assert.True(t, isLoopback("[::1]:33033"))
+	assert.False(t, isLoopback("0.0.0.0:33033"))
+	assert.False(t, isLoopback("10.1.2.3:33033"))
+}
@@ -15,7 +15,13 @@ import (
 func AddCommonFlags(cmd *cobra.Command) {
 	cmd.Flags().StringP("address", "a", "127.0.0.1", "The IP address where mirror is accessible")
 	cmd.Flags().IntP("port", "p", 33033, "The port on which mirror is accessible")
-	cmd.Flags().String("kubeconfig", "~/.kube/config", "Path to the kubeconfig file")
+	cmd.Flags().String("socket", "", "Path of the Unix socket the watch server is accessible on (default is kubectl-ac/watch.sock in $XDG_RUNTIME_DIR)")
+	cmd.Flags().Bool("tcp", false, "Access the watch server over TCP on --address and --port rather than a Unix socket. Anyone on the host can connect to it")
+	cmd.Flags().String("tls-cert", "", "Certificate file for TLS over TCP: the watch server's certificate, or the client certificate to present to it")
+	cmd.Flags().String("tls-key", "", "Key file for --tls-cert")
+	cmd.Flags().String("tls-ca", "", "CA certificate file for TLS over TCP: the watch server only accepts clients with a certificate it signed, clients verify the watch server's certificate with it")
+	cmd.Flags().String("token-file", "", "File holding the token clients present to a watch server on TCP without --tls-ca. The server keeps the token already in it, so it can be shared with clients on other hosts (default is kubectl-ac/token in $XDG_RUNTIME_DIR, which clients only present to a loopback address)")
+	cmd.Flags().String("kubeconfig", "", "Path to the kubeconfig file (default is the files in $KUBECONFIG merged together, or else ~/.kube/config)")
 	cmd.Flags().BoolP("info", "i", false, "Enables verbose output")
 	cmd.Flags().BoolP("verbose", "v", false, "Enables very verbose output")
 	cmd.Flags().Bool("syslog", false, "Send log output to syslog")
@@ -47,10 +53,9 @@ func RunCommon(cmd *cobra.Command) error {
 		return err
 	}
 
-	// if kubeconfig hasn't been set then set it to the default location
+	// without a kubeconfig file kubeconfig is loaded like kubectl does, from $KUBECONFIG or else the default location
 	if strings.TrimSpace(kubeConfigFile) == "" {
-		log.Debug("Setting kubeconfig location to default")
-		kubeConfigFile = "~/.kube/config"
+		return nil
 	}
 
 	// if the path to the user's kubeconfig file starts with a ~ then convert this to an absolute path
@@ -67,13 +72,33 @@ func RunCommon(cmd *cobra.Command) error {
 func BuildConfigFromFlags(context, kubeconfigPath string) (*rest.Config, error) {
 	log.Infof("context: %s, path: %s", context, kubeconfigPath)
 	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
+		loadingRules(kubeconfigPath),
 		&clientcmd.ConfigOverrides{
 			CurrentContext: context,
 		}).ClientConfig()
 }
 
+// The address the watch server listens on: a Unix socket unless TCP was asked for with --tcp, --address, --port
+// or any of the TLS flags
 func GetBind(cmd *cobra.Command) (string, error) {
+	useTCP, err := cmd.Flags().GetBool("tcp")
+	if err != nil {
+		return "", err
+	}
+	for _, f := range []string{"address", "port", "tls-cert", "tls-ca"} {
+		useTCP = useTCP || cmd.Flags().Changed(f)
+	}
+	if !useTCP {
+		socket, err := cmd.Flags().GetString("socket")
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(socket) == "" {
+			socket = defaultSocketPath()
+		}
+		return unixPrefix + socket, nil
+	}
+
 	address, err := cmd.Flags().GetString("address")
 	if err != nil {
 		return "", err
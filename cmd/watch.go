@@ -3,18 +3,34 @@ package cmd
 import (
 	"autocli/model"
 	"autocli/service"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-
-	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/cenkalti/backoff"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
+// How long pinging a context's server or asking it for its resource types may take. Stopping a context waits for
+// these, so one whose server can't be reached mustn't hold up a shutdown or a reload for long
+const discoveryTimeout = 5 * time.Second
+
 func NewWatchCommand(b Builder) *cobra.Command {
 	var watchCmd = &cobra.Command{
 		Use:          "watch [flags] [contexts]...",
@@ -33,14 +49,18 @@ func NewWatchCommand(b Builder) *cobra.Command {
 
 	AddCommonFlags(watchCmd)
 	watchCmd.Flags().Duration("interval", 2*time.Minute, "Interval between requests to the server")
+	watchCmd.Flags().MarkDeprecated("interval", "every kind, nodes included, is now watched")
 	watchCmd.Flags().String("only", "", "Coma-separated names of resources to watch, empty to watch all supported")
+	watchCmd.Flags().String("snapshot", "", "File the cache is periodically saved to and loaded from at startup (default is kubectl-ac/snapshot.json in the user cache dir)")
+	watchCmd.Flags().Duration("snapshot-interval", time.Minute, "Interval between saving the cache to the snapshot file, 0 disables the snapshot")
+	watchCmd.Flags().Duration("idle-timeout", 0, "Stop watching contexts that haven't been queried for this long and exit once nothing has been, 0 never stops")
+	watchCmd.Flags().StringArray("namespaces", nil, "Namespaces to watch namespaced kinds in rather than across the cluster, as [context=]namespace,namespace... Repeat for each context, a list without a context is for all of them")
+	watchCmd.Flags().String("resources", "", "Comma-separated names of further resources to watch, including CRDs, e.g. certificates.cert-manager.io,kt. Names are resolved through API discovery like kubectl does")
 
 	return watchCmd
 }
 
 func RunWatch(b Builder, cmd *cobra.Command, args []string) error {
-	clients := make(map[string]kubernetes.Interface)
-
 	kubeConfigFile, err := cmd.Flags().GetString("kubeconfig")
 	if err != nil {
 		log.Error(err)
@@ -54,148 +74,648 @@ func RunWatch(b Builder, cmd *cobra.Command, args []string) error {
 		return errors.New(msg)
 	}
 
-	l, err := net.Listen("tcp", bind)
+	tf, err := GetTLSFiles(cmd)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	var tlsConfig *tls.Config
+	if tf.enabled() {
+		if tlsConfig, err = serverTLSConfig(tf); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	l, err := listen(bind)
 	if err != nil {
 		msg := fmt.Sprintf("failed to bind on %s: %v", bind, err)
 		log.Error(msg)
 		return errors.New(msg)
 	}
+	// closing the listener also removes the socket
+	defer l.Close()
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	} else if network, _ := splitBind(bind); network == "tcp" && !isLoopback(bind) {
+		log.WithField("bind", bind).Warn("listening on a non-loopback address without TLS, the token is sent in the clear")
+	}
 
-	interval, err := cmd.Flags().GetDuration("interval")
+	enabledResources, err := cmd.Flags().GetString("only")
 	if err != nil {
-		msg := fmt.Sprintf("could not parse value of --interval")
+		msg := fmt.Sprintf("could not parse value of --only")
 		log.Error(msg)
 		return errors.New(msg)
 	}
 
-	enabledResources, err := cmd.Flags().GetString("only")
+	extraResources, err := cmd.Flags().GetString("resources")
 	if err != nil {
-		msg := fmt.Sprintf("could not parse value of --only")
+		msg := fmt.Sprintf("could not parse value of --resources")
+		log.Error(msg)
+		return errors.New(msg)
+	}
+
+	snapshotPath, err := cmd.Flags().GetString("snapshot")
+	if err != nil {
+		msg := fmt.Sprintf("could not parse value of --snapshot")
+		log.Error(msg)
+		return errors.New(msg)
+	}
+	if strings.TrimSpace(snapshotPath) == "" {
+		snapshotPath = defaultSnapshotPath()
+	}
+
+	snapshotInterval, err := cmd.Flags().GetDuration("snapshot-interval")
+	if err != nil {
+		msg := fmt.Sprintf("could not parse value of --snapshot-interval")
+		log.Error(msg)
+		return errors.New(msg)
+	}
+
+	// everything the server runs stops once the root context is cancelled, by a signal or through RPC
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.WithField("signal", sig).Info("received signal, shutting down")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	namespaceValues, err := cmd.Flags().GetStringArray("namespaces")
+	if err != nil {
+		msg := fmt.Sprintf("could not parse value of --namespaces")
+		log.Error(msg)
+		return errors.New(msg)
+	}
+	namespaces, err := parseNamespaces(namespaceValues)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	idleTimeout, err := cmd.Flags().GetDuration("idle-timeout")
+	if err != nil {
+		msg := fmt.Sprintf("could not parse value of --idle-timeout")
 		log.Error(msg)
 		return errors.New(msg)
 	}
 
 	c := b.WatchCache()
+	c.shutdown = cancel
+	w := &watcher{
+		c:                 c,
+		kc:                b.KubeClient(make(map[string]kubernetes.Interface), make(map[string]dynamic.Interface)),
+		kubeConfigFile:    kubeConfigFile,
+		clientKubeConfigs: acceptsClientKubeConfigs(bind, tf),
+		only:              enabledResources,
+		extraResources:    extraResources,
+		namespaces:        namespaces,
+		contexts:          make(map[string]*watchedContext),
+		mu:                &sync.Mutex{},
+	}
+	c.watcher = w
 
-	for _, arg := range args {
-		cc, err := BuildConfigFromFlags(arg, kubeConfigFile)
-		if err != nil {
-			log.Error(err)
+	// serve whatever was cached before the last shutdown straight away, while the informers catch up
+	var snapshotDone <-chan struct{}
+	if snapshotInterval > 0 {
+		w.snapshotPath = snapshotPath
+		snapshotDone = loopSnapshot(ctx, c, snapshotPath, snapshotInterval)
+	}
+	defer w.stopAll()
+
+	// a context that can't be watched doesn't stop the others, clients asking for it get the error
+	for _, s := range args {
+		if err := w.addContext(s); err != nil {
+			log.WithField("context", s).Error(err)
+		}
+	}
+	loopKubeConfig(ctx, w, kubeConfigCheckInterval)
+	if idleTimeout > 0 {
+		loopIdle(ctx, w, idleTimeout, cancel)
+	}
+
+	// record where the server is and how it was started, for the stop, status and restart commands
+	flags := []string{}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		// a flag that can be repeated is recorded once for each of its values
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range sv.GetSlice() {
+				flags = append(flags, fmt.Sprintf("--%s=%s", f.Name, v))
+			}
+			return
+		}
+		flags = append(flags, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+	})
+	w.state = &serverState{
+		PID:        os.Getpid(),
+		Address:    bind,
+		Version:    BuildVersion,
+		StartedAt:  c.startedAt,
+		Flags:      flags,
+		KubeConfig: os.Getenv("KUBECONFIG"),
+	}
+	w.mu.Lock()
+	w.saveState()
+	w.mu.Unlock()
+	defer removeState(statePath(), os.Getpid())
+
+	// the socket is only open to the user but anyone on the host can connect over TCP, so clients have to
+	// present a token only the user can read, or that's been shared through --token-file - unless they're
+	// verified by their certificates
+	token := ""
+	if network, _ := splitBind(bind); network == "tcp" && tf.CA == "" {
+		if token, err = serverToken(tf.tokenFile(), tf.Token != ""); err != nil {
 			return err
 		}
+	}
+
+	// stop accepting connections once shut down, which makes Serve return
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	log.WithField("bind", bind).Info("started to listen")
+	err = b.Serve(l, c, token)
+	if ctx.Err() == nil {
+		return fmt.Errorf("unexpected error: %v", err)
+	}
+
+	// stop the watches first, so the final snapshot holds everything they received
+	w.stopAll()
+	if snapshotInterval > 0 {
+		<-snapshotDone
+		saveSnapshot(c, snapshotPath)
+	}
+	// a shared token stays for the server's next start
+	if token != "" && tf.Token == "" {
+		removeToken(tf.tokenFile(), token)
+	}
+	log.Info("watch server has shut down")
+
+	return nil
+}
+
+/*
+Whether a watch server on the bind address watches contexts from kubeconfig files its clients name. Only the user
+can reach the socket, or a loopback address, so the files are theirs; a server others can reach would otherwise load
+any file they name on its host, and a kubeconfig can run commands through exec credential plugins. A server shared
+through TLS client certificates doesn't either - the files are the user's running it, not the client's
+*/
+func acceptsClientKubeConfigs(bind string, tf TLSFiles) bool {
+	network, address := splitBind(bind)
+
+	return tf.CA == "" && (network == "unix" || isLoopback(address))
+}
+
+// The contexts a watch server is watching. Contexts can be added and removed through RPC while the server is running
+type watcher struct {
+	c  *WatchCache
+	kc service.KubeClient
+	// the file given in --kubeconfig, blank to load kubeconfig the way kubectl does
+	kubeConfigFile string
+	// whether contexts from kubeconfig files named by clients are watched, see acceptsClientKubeConfigs
+	clientKubeConfigs bool
+	only              string
+	extraResources    string
+	// the namespaces given in --namespaces for each context, "" for every context
+	namespaces map[string][]string
+	// the snapshot a newly added context is warm-started from, blank if snapshots are disabled
+	snapshotPath string
+	contexts     map[string]*watchedContext
+	// written to the state file whenever the contexts change, nil if there's no state file
+	state *serverState
+	// set once the server is shutting down, after which no more contexts are added
+	stopped bool
+	mu      *sync.Mutex
+}
+
+type watchedContext struct {
+	// the context's definition in kubeconfig when its clients were built
+	definition string
+	// closed to stop watching the context
+	stop chan struct{}
+	// the goroutines writing the context's resources and watch states into the cache
+	wg *sync.WaitGroup
+}
+
+// Create the clients for a context from the kubeconfig and start watching it. Adding a context that's
+// already watched does nothing
+func (w *watcher) addContext(ctx string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		return errors.New("the watch server is shutting down")
+	}
+	if _, ok := w.contexts[ctx]; ok {
+		return nil
+	}
+
+	wc, err := w.startContext(ctx, true)
+	if err != nil {
+		return err
+	}
+	w.contexts[ctx] = wc
+	w.saveState()
+	// a context that's just been added gets the full idle timeout before it's dropped
+	w.c.touch(ctx)
+	log.WithField("context", ctx).Info("started to watch context")
+
+	return nil
+}
+
+// Stop watching a context and drop everything cached for it
+func (w *watcher) removeContext(ctx string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wc, ok := w.contexts[ctx]
+	if !ok {
+		return fmt.Errorf("context %s is not being watched", ctx)
+	}
+
+	w.stopContext(ctx, wc)
+	w.c.removeContext(ctx)
+	delete(w.contexts, ctx)
+	w.saveState()
+	log.WithField("context", ctx).Info("stopped watching context")
+
+	return nil
+}
+
+/*
+Compare the definition of every watched context in the kubeconfig with the one its clients were built from and
+restart the watches of those that changed, e.g. because their credentials were rotated. Their cached resources are
+kept and get swapped out by the first full listing with the new clients; other contexts aren't touched
+*/
+func (w *watcher) reloadKubeConfig() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// keyed by the kubeconfig file the contexts are loaded from
+	definitions := make(map[string]map[string]string)
+	for ctx, wc := range w.contexts {
+		l := log.WithField("context", ctx)
+		name, kubeConfigFile := w.kubeConfigFor(ctx)
+		if _, ok := definitions[kubeConfigFile]; !ok {
+			defs, err := contextDefinitions(kubeConfigFile)
+			if err != nil {
+				l.WithField("error", err).Error("failed to reload kubeconfig")
+				continue
+			}
+			definitions[kubeConfigFile] = defs
+		}
+		definition, ok := definitions[kubeConfigFile][name]
+		if !ok {
+			l.Warn("context has gone from kubeconfig, still watching it with the clients it was started with")
+			continue
+		}
+		if definition == wc.definition {
+			continue
+		}
 
-		clientset, err := kubernetes.NewForConfig(cc)
+		l.Info("context has changed in kubeconfig, restarting its watches")
+		w.stopContext(ctx, wc)
+		delete(w.contexts, ctx)
+		restarted, err := w.startContext(ctx, false)
 		if err != nil {
-			log.Error(err)
-			return err
+			// drop what's cached so a client asking for the context adds it again rather than getting stale resources
+			l.WithField("error", err).Error("failed to restart context")
+			w.c.removeContext(ctx)
+			w.saveState()
+			continue
 		}
-		clients[arg] = clientset
-		fields := log.Fields{
-			"context": arg,
-			"host":    cc.Host,
+		w.contexts[ctx] = restarted
+	}
+}
+
+/*
+Build the clients for a context from the kubeconfig and start watching it. The watch loops are started once the
+server is reachable, which is retried in the background so an unreachable context doesn't hold anything else up.
+A warm start loads the context's resources from the snapshot first, so they're served in the meantime. The caller
+must hold the lock
+*/
+func (w *watcher) startContext(ctx string, warm bool) (*watchedContext, error) {
+	name, kubeConfigFile := w.kubeConfigFor(ctx)
+	if kubeConfigFile != w.kubeConfigFile && !w.clientKubeConfigs {
+		return nil, fmt.Errorf("context %s is from a kubeconfig file this watch server doesn't load", ctx)
+	}
+	definitions, err := contextDefinitions(kubeConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := definitions[name]; !ok {
+		return nil, fmt.Errorf("context %s not found in kubeconfig", ctx)
+	}
+
+	cc, err := BuildConfigFromFlags(name, kubeConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(cc)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(cc)
+	if err != nil {
+		return nil, err
+	}
+	// the clientset's requests can't time out as its watches are long running, discovery's can
+	dc := rest.CopyConfig(cc)
+	dc.Timeout = discoveryTimeout
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(dc)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := contextNamespaces(kubeConfigFile, name, w.namespaces)
+	if err != nil {
+		return nil, err
+	}
+	fields := log.Fields{
+		"context":    ctx,
+		"host":       cc.Host,
+		"namespaces": namespaces.Watch,
+	}
+	log.WithFields(fields).Info("created client")
+
+	w.kc.AddContext(ctx, clientset, dynamicClient, discoveryClient)
+	w.kc.SetNamespaces(ctx, namespaces)
+	if warm && w.snapshotPath != "" {
+		warmStart(w.c, w.snapshotPath, []string{ctx})
+		if rv := w.c.resourceVersion(ctx); rv != "" {
+			w.kc.ResumeFrom(ctx, rv)
 		}
-		log.WithFields(fields).Info("created client")
 	}
 
-	kc := b.KubeClient(clients)
+	wc := &watchedContext{
+		definition: definitions[name],
+		stop:       make(chan struct{}),
+		wg:         &sync.WaitGroup{},
+	}
+	w.c.setContextState(ctx, Syncing, nil)
+	wc.wg.Add(1)
+	go func() {
+		defer wc.wg.Done()
+		if w.connect(ctx, wc) {
+			w.c.setContextState(ctx, Watching, nil)
+			w.watchResources(ctx, wc)
+		}
+	}()
+
+	return wc, nil
+}
+
+// Check the context's server is reachable, backing off between attempts until it is. Returns false if the context
+// was stopped first
+func (w *watcher) connect(ctx string, wc *watchedContext) bool {
+	l := log.WithField("context", ctx)
+	boff := backoff.NewExponentialBackOff()
+	boff.MaxElapsedTime = 0 // never give up
+	for {
+		err := w.kc.Ping(ctx)
+		if err == nil {
+			return true
+		}
 
-	for _, ctx := range args {
-		if err := kc.Ping(ctx); err != nil {
-			msg := fmt.Sprintf("failed to ping server: %s", err)
-			log.Error(msg)
-			return errors.New(msg)
+		wait := boff.NextBackOff()
+		err = fmt.Errorf("failed to ping server: %s", err)
+		l.WithField("error", err).Warnf("server isn't reachable, retrying in %s", wait)
+		w.c.setContextState(ctx, BackingOff, err)
+		select {
+		case <-time.After(wait):
+		case <-wc.stop:
+			return false
 		}
 	}
+}
 
-	for _, ctx := range args {
-		for _, watchResource := range []string{"pod"} {
-			if isWatching(watchResource, enabledResources) {
-				loopWatchObjects(c, kc, watchResource, ctx)
-			}
+// Start the watch loops for the context's resources
+func (w *watcher) watchResources(ctx string, wc *watchedContext) {
+	watched := []string{}
+	for _, h := range service.KindHandlers() {
+		// handlers such as 'log' select from a kind another handler watches
+		if h.Name() != h.Kind() || !isWatching(h.Kind(), w.only) {
+			continue
+		}
+		loopWatchObjects(w.c, w.kc, h.Kind(), ctx, wc)
+		watched = append(watched, h.Kind())
+	}
+	watchDiscoveredResources(w.c, w.kc, w.extraResources, ctx, watched, wc)
+}
+
+// The name of a watched context in kubeconfig and the kubeconfig it's loaded from: a file, or a list of files
+// merged together like $KUBECONFIG
+func (w *watcher) kubeConfigFor(ctx string) (string, string) {
+	name, files := splitContext(ctx)
+	if len(files) == 0 {
+		return name, w.kubeConfigFile
+	}
+
+	return name, strings.Join(files, string(filepath.ListSeparator))
+}
+
+/*
+The context a client knows by the name in its kubeconfig files: the server's own context of that name if the client's
+is defined in the same file, or else the client's qualified with all of its files, as its cluster and user may be
+defined in another one. A client's files the server can't read, e.g. because they're on another host, are taken to
+be the same as the server's
+*/
+func (w *watcher) contextFor(name string, files []string) string {
+	if !w.clientKubeConfigs {
+		return name
+	}
+	origin := contextOrigin(&clientcmd.ClientConfigLoadingRules{Precedence: files}, name)
+	if origin == "" || origin == contextOrigin(loadingRules(w.kubeConfigFile), name) {
+		return name
+	}
+
+	qualified := make([]string, 0, len(files))
+	for _, f := range files {
+		if abs, err := filepath.Abs(f); err == nil && !Contains(qualified, abs) {
+			qualified = append(qualified, abs)
 		}
+	}
+
+	return qualifiedContext(name, qualified)
+}
+
+// The kubeconfig files the watched contexts are loaded from
+func (w *watcher) kubeConfigFiles() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-		for _, getResource := range []string{"node"} {
-			if isWatching(getResource, enabledResources) {
-				loopGetObjects(c, kc, getResource, ctx, interval)
+	files := kubeConfigFiles(w.kubeConfigFile)
+	for ctx := range w.contexts {
+		_, qualified := splitContext(ctx)
+		for _, file := range qualified {
+			if !Contains(files, file) {
+				files = append(files, file)
 			}
 		}
 	}
 
-	log.WithField("bind", bind).Info("started to listen")
-	err = b.Serve(l, c)
-	if err != nil {
-		return fmt.Errorf("unexpected error: %v", err)
+	return files
+}
+
+// Stop the watch loops and informers of a context. The caller must hold the lock
+func (w *watcher) stopContext(ctx string, wc *watchedContext) {
+	close(wc.stop)
+	w.kc.RemoveContext(ctx)
+	// wait for anything in flight to land in the cache, so nothing turns up after the caller is done with it
+	wc.wg.Wait()
+}
+
+// Stop watching every context, keeping what's cached for them. Stopping again does nothing
+func (w *watcher) stopAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopped = true
+	for ctx, wc := range w.contexts {
+		w.stopContext(ctx, wc)
+		delete(w.contexts, ctx)
+	}
+}
+
+func (w *watcher) contextNames() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.sortedContexts()
+}
+
+// Record the contexts being watched in the state file. The caller must hold the lock
+func (w *watcher) saveState() {
+	if w.state == nil {
+		return
+	}
+	w.state.Contexts = w.sortedContexts()
+	if err := writeState(statePath(), w.state); err != nil {
+		log.WithField("error", err).Error("failed to write state file")
+	}
+}
+
+// The caller must hold the lock
+func (w *watcher) sortedContexts() []string {
+	names := make([]string, 0, len(w.contexts))
+	for ctx := range w.contexts {
+		names = append(names, ctx)
 	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Resolve the names passed in --resources through the context's API discovery and watch each of them, as the kind
+// qualified by its group unless a registered handler watches it. A resource the cluster doesn't serve (e.g. a CRD
+// that isn't installed) is skipped for that context only
+func watchDiscoveredResources(c *WatchCache, kc service.KubeClient, names, context string, watched []string, wc *watchedContext) {
+	for _, name := range strings.Split(names, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		// each name may take until discovery times out, which stopping the context shouldn't wait for
+		select {
+		case <-wc.stop:
+			return
+		default:
+		}
+
+		l := log.WithField("resource", name).WithField("context", context)
+		rt, err := kc.ResolveKind(context, name)
+		if err != nil {
+			l.WithField("error", err).Error("cannot watch resource")
+			c.setWatchState(context, name, Failed, err)
+			continue
+		}
+		kind := service.WatchedKind(rt)
+		if Contains(watched, kind) {
+			l.Info("resource is already watched")
+			continue
+		}
 
-	return errors.New("watch has stopped")
+		c.registerResourceType(context, rt)
+		loopWatchObjects(c, kc, kind, context, wc)
+		watched = append(watched, kind)
+	}
 }
 
 func isWatching(r string, rs string) bool {
 	return len(rs) == 0 || strings.Contains(rs, r)
 }
 
-func loopWatchObjects(c *WatchCache, kc service.KubeClient, kind, context string) {
+func loopWatchObjects(c *WatchCache, kc service.KubeClient, kind, context string, wc *watchedContext) {
 	events := make(chan *model.ResourceEvent)
 	l := log.WithField("kind", kind).WithField("context", context)
 
+	/*
+		The informers behind WatchResources take care of reconnecting and relisting, so it only returns if the
+		watch couldn't be set up at all. Back off before trying again so a flapping apiserver doesn't get hammered,
+		and leave whatever is cached in place - it gets swapped out by the next full listing.
+	*/
 	watch := func() {
+		defer wc.wg.Done()
+		boff := backoff.NewExponentialBackOff()
+		boff.MaxElapsedTime = 0 // never give up
 		for {
 			l.Info("started to watch")
+			c.setWatchState(context, kind, Syncing, nil)
 			err := kc.WatchResources(context, kind, events)
 			fields := log.Fields{}
 			if err != nil {
 				fields["error"] = err.Error()
 			}
-			l.WithFields(fields).Info("watch connection was closed, retrying")
-			c.deleteKubeObjects(context, kind)
+			select {
+			case <-wc.stop:
+				l.WithFields(fields).Info("watch stopped")
+				return
+			default:
+			}
+
+			wait := boff.NextBackOff()
+			l.WithFields(fields).Infof("watch stopped, retrying in %s", wait)
+			c.setWatchState(context, kind, BackingOff, err)
+			select {
+			case <-time.After(wait):
+			case <-wc.stop:
+				return
+			}
 		}
 	}
 
 	update := func() {
+		defer wc.wg.Done()
 		for {
 			select {
+			case <-wc.stop:
+				return
 			case e := <-events:
-				l.
-					WithField("name", e.Resource.Name).
-					WithField("type", e.Type).
-					Info("received event")
 				switch e.Type {
 				case model.Deleted:
+					l.WithField("name", e.Resource.Name).WithField("type", e.Type).Info("received event")
 					c.deleteKubeObject(context, *e.Resource)
 				case model.Added, model.Modified:
+					l.WithField("name", e.Resource.Name).WithField("type", e.Type).Info("received event")
 					c.updateKubeObject(context, *e.Resource)
+				case model.Replaced:
+					l.WithField("type", e.Type).Infof("received %d resources", len(e.Resources))
+					c.replaceKubeObjects(context, kind, e.Resources)
+					c.setResourceVersion(context, e.ResourceVersion)
+					c.setWatchState(context, kind, Watching, nil)
 				}
 				l.WithField("cache", c.Resources).Debugf("objects in cache")
 			}
 		}
 	}
 
+	wc.wg.Add(2)
 	go watch()
 	go update()
 }
-
-func loopGetObjects(c *WatchCache, kc service.KubeClient, kind, context string, interval time.Duration) {
-	l := log.WithField("kind", kind).WithField("context", context)
-	update := func() {
-		for {
-			l.Info("updating resource...")
-			resources, err := kc.GetResources(context, kind)
-			if err != nil {
-				l.WithField("error", err).Error("unexpected error while updating resources")
-				time.Sleep(10 * time.Second)
-				continue
-			}
-
-			l.WithField("resources", resources).Debug("received resources")
-			c.deleteKubeObjects(context, kind)
-			for i := range resources {
-				c.updateKubeObject(context, resources[i])
-			}
-			l.Infof("put %d resources into cache", len(resources))
-
-			time.Sleep(interval)
-		}
-	}
-
-	go update()
-}
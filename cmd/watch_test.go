@@ -3,69 +3,286 @@ package cmd
 import (
 	"autocli/model"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
 
 func TestRunWatch(t *testing.T) {
+	// keep the token the server writes for TCP clients out of the user's runtime dir
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+
 	b := NewTestBuilder()
 	servers := []string{"prod", "dev"}
 	cmd := NewWatchCommand(b)
 	cmd.Flags().Set("kubeconfig", "test_data/kubeconfig_valid")
 	cmd.Flags().Set("port", "33044")
+	cmd.Flags().Set("resources", "cert,unknown")
+	cmd.Flags().Set("namespaces", "dev=ns1,ns2")
+	cmd.Flags().Set("namespaces", "prod=ns1")
+	cmd.Flags().Set("snapshot-interval", "0")
 	//cmd.Flags().Set("verbose", "true")
 
-	go cmd.RunE(cmd, servers)
-	time.Sleep(50 * time.Millisecond)
+	done := make(chan error)
+	go func() {
+		done <- cmd.RunE(cmd, servers)
+	}()
 
 	bind, err := GetBind(cmd)
 	if err != nil {
-		t.Errorf("unexpected error: %s", err)
+		t.Fatalf("unexpected error: %s", err)
 	}
 
-	client, err := b.WatchClient(bind, "", "", "")
-	if err != nil {
-		t.Errorf("could not create client to autocli: %s", err)
-	}
-	wf := makeFilter("prod", "", "pod")
-	var kr []model.KubeResource
-	for {
-		kr, err = client.Resources(wf)
-		if err != nil {
-			t.Error(err)
-			break
-		}
-		if len(kr) > 0 {
+	var client WatchClient
+	for i := 0; i < 100; i++ {
+		if client, err = b.WatchClient(bind, "", "", "", TLSFiles{}); err == nil {
 			break
 		}
+		time.Sleep(10 * time.Millisecond)
 	}
+	if err != nil {
+		t.Fatalf("could not create client to autocli: %s", err)
+	}
+	// stop the server before the runtime dir is restored, so the port is free for the next run
+	defer func() {
+		assert.NoError(t, client.Shutdown())
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("the server didn't shut down")
+		}
+	}()
+	wf := makeFilter("prod", "", "pod")
+	kr := waitForResources(t, client, wf)
 
 	assert.Equal(t, "pod", kr[0].Kind)
 	assert.Equal(t, "ns1-pod", kr[0].Name)
 	assert.Equal(t, "ns1", kr[0].Namespace)
 
 	wf = makeFilter("dev", "ns2", "pod")
-	for {
-		kr, err = client.Resources(wf)
-		if err != nil {
-			t.Error(err)
-			break
-		}
-		if len(kr) > 0 {
-			break
-		}
-	}
+	kr = waitForResources(t, client, wf)
 
 	assert.Equal(t, "pod", kr[0].Kind)
 	assert.Equal(t, "ns2-pod", kr[0].Name)
 	assert.Equal(t, "ns2", kr[0].Namespace)
 
+	wf = makeFilter("dev", "", "certificates")
+	kr = waitForResources(t, client, wf)
+
+	assert.Equal(t, "certificate", kr[0].Kind)
+
 	wf = makeFilter("prod", "", "node")
-	kr, err = client.Resources(wf)
-	if err != nil {
-		t.Error(err)
-	}
+	kr = waitForResources(t, client, wf)
 	assert.Equal(t, 2, len(kr))
 	assert.Equal(t, "prodnode2", kr[1].Name)
 	assert.Equal(t, "NotReady", kr[1].Status)
+
+	assert.Eventually(t, func() bool {
+		names, _ := namespaceNames(client, "dev")
+		return len(names) > 0
+	}, 5*time.Second, 10*time.Millisecond, "the server didn't cache the context's namespaces")
+	assert.NoError(t, checkNamespace(client, "dev", "ns2"))
+	assert.EqualError(t, checkNamespace(client, "dev", "ns3"), `namespace "ns3" not found in context dev, did you mean "ns1"?`)
+
+	state, err := readState(statePath())
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.Getpid(), state.PID)
+		assert.Equal(t, bind, state.Address)
+		assert.Equal(t, []string{"dev", "prod"}, state.Contexts)
+		assert.Contains(t, state.Flags, "--port=33044")
+		assert.Contains(t, state.Flags, "--namespaces=dev=ns1,ns2")
+		assert.Contains(t, state.Flags, "--namespaces=prod=ns1")
+	}
+}
+
+// Ask for resources until some are cached, failing the test if none are within a few seconds
+func waitForResources(t *testing.T, client WatchClient, wf WatchFilter) []model.KubeResource {
+	var kr []model.KubeResource
+	cached := func() bool {
+		var err error
+		kr, err = client.Resources(wf)
+		return err == nil && len(kr) > 0
+	}
+	if !assert.Eventually(t, cached, 5*time.Second, 10*time.Millisecond, "no %s cached for context %s", wf.Kind, wf.Context) {
+		t.FailNow()
+	}
+
+	return kr
+}
+
+func TestWatchShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+
+	b := NewTestBuilder()
+	cmd := NewWatchCommand(b)
+	cmd.Flags().Set("kubeconfig", "test_data/kubeconfig_valid")
+	cmd.Flags().Set("socket", filepath.Join(dir, "watch.sock"))
+	cmd.Flags().Set("snapshot", filepath.Join(dir, "snapshot.json"))
+	cmd.Flags().Set("snapshot-interval", "1h")
+
+	done := make(chan error)
+	go func() {
+		done <- cmd.RunE(cmd, []string{"prod"})
+	}()
+
+	bind, err := GetBind(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var client WatchClient
+	var kr []model.KubeResource
+	for i := 0; i < 100 && len(kr) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if client == nil {
+			if client, err = b.WatchClient(bind, "", "", "", TLSFiles{}); err != nil {
+				client = nil
+				continue
+			}
+		}
+		kr, _ = client.Resources(makeFilter("prod", "", "pod"))
+	}
+	if !assert.NotEmpty(t, kr, "the server didn't cache the context's pods") {
+		return
+	}
+
+	assert.NoError(t, client.Shutdown())
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server didn't shut down")
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "watch.sock"))
+	assert.True(t, os.IsNotExist(err), "the socket should have been removed")
+	_, err = os.Stat(statePath())
+	assert.True(t, os.IsNotExist(err), "the state file should have been removed")
+	snap, err := readSnapshot(filepath.Join(dir, "snapshot.json"))
+	if assert.NoError(t, err, "a snapshot should have been saved on shutdown") {
+		assert.NotEmpty(t, snap.Contexts["prod"].Resources)
+		assert.Equal(t, "100", snap.Contexts["prod"].ResourceVersion)
+	}
+}
+
+func TestWatcherAddRemoveContext(t *testing.T) {
+	b := NewTestBuilder()
+	c := b.WatchCache()
+	w := &watcher{
+		c:              c,
+		kc:             b.KubeClient(map[string]kubernetes.Interface{}, map[string]dynamic.Interface{}),
+		kubeConfigFile: "test_data/kubeconfig_valid",
+		only:           "pod",
+		namespaces:     map[string][]string{"": {"ns2"}},
+		contexts:       make(map[string]*watchedContext),
+		mu:             &sync.Mutex{},
+	}
+
+	assert.Error(t, w.addContext("unknown"))
+	assert.NoError(t, w.addContext("dev"))
+	assert.Equal(t, []string{"ns2"}, b.(*TestBuilder).testKubeClient.namespaces["dev"].Watch)
+	assert.NoError(t, w.addContext("dev"))
+	assert.Equal(t, []string{"dev"}, w.contextNames())
+
+	for len(c.objects("dev")) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.NoError(t, w.removeContext("dev"))
+	assert.Error(t, w.removeContext("dev"))
+	assert.Equal(t, []string{}, w.contextNames())
+	assert.Nil(t, c.objects("dev"))
+}
+
+func TestWatcherWarmStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	saved := NewWatchCache()
+	saved.updateKubeObject("dev", model.KubeResource{TypeMeta: model.TypeMeta{Kind: "pod"}, ResourceMeta: model.ResourceMeta{Name: "p1", Namespace: "ns2"}})
+	saved.setResourceVersion("dev", "50")
+	assert.NoError(t, writeSnapshot(path, saved.snapshot()))
+
+	b := NewTestBuilder()
+	c := b.WatchCache()
+	w := &watcher{
+		c:              c,
+		kc:             b.KubeClient(map[string]kubernetes.Interface{}, map[string]dynamic.Interface{}),
+		kubeConfigFile: "test_data/kubeconfig_valid",
+		only:           "pod",
+		contexts:       make(map[string]*watchedContext),
+		mu:             &sync.Mutex{},
+		snapshotPath:   path,
+	}
+	assert.NoError(t, w.addContext("dev"))
+	defer w.removeContext("dev")
+
+	// the informers resume from the snapshot's listing
+	assert.Equal(t, "50", b.(*TestBuilder).testKubeClient.resumeFrom["dev"])
+	assert.Equal(t, "50", c.resourceVersion("dev"))
+}
+
+func TestWatcherUnreachableContext(t *testing.T) {
+	b := NewTestBuilder()
+	c := b.WatchCache()
+	kc := b.KubeClient(map[string]kubernetes.Interface{}, map[string]dynamic.Interface{}).(*TestKubeClient)
+	w := &watcher{
+		c:              c,
+		kc:             kc,
+		kubeConfigFile: "test_data/kubeconfig_valid",
+		only:           "pod",
+		contexts:       make(map[string]*watchedContext),
+		mu:             &sync.Mutex{},
+	}
+	kc.setReachable("dev", false)
+
+	// an unreachable context doesn't stop the others from being watched
+	assert.NoError(t, w.addContext("dev"))
+	assert.NoError(t, w.addContext("prod"))
+	for len(c.objects("prod")) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	dev := "dev"
+	status := &ServerStatus{}
+	for status.Contexts == nil || status.Contexts[0].State != BackingOff {
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, c.ServerStatus(&dev, status))
+	}
+	assert.Contains(t, status.Contexts[0].LastError, "failed to ping server")
+	var count int
+	err := c.Status(&dev, &count)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "isn't available yet")
+	}
+
+	// it's retried until it can be reached
+	kc.setReachable("dev", true)
+	for len(c.objects("dev")) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NoError(t, c.ServerStatus(&dev, status))
+	assert.Equal(t, Watching, status.Contexts[0].State)
+
+	w.stopAll()
 }
@@ -17,7 +17,10 @@ func main() {
 	//rootCmd := cmd.NewGetCommand(b)
 	RootCmd.AddCommand(cmd.NewVersionCommand(b))
 	RootCmd.AddCommand(cmd.NewWatchCommand(b))
+	RootCmd.AddCommand(cmd.NewStopCommand(b))
+	RootCmd.AddCommand(cmd.NewRestartCommand(b))
 	RootCmd.AddCommand(cmd.NewResourcesCommand(b))
+	RootCmd.AddCommand(cmd.NewStatusCommand(b))
 	if err := RootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
@@ -1,11 +1,15 @@
 package model
 
+import "time"
+
 type EventType string
 
 const (
 	Added    EventType = "ADDED"
 	Modified EventType = "MODIFIED"
 	Deleted  EventType = "DELETED"
+	// Replaced carries a complete listing of a kind, which supersedes whatever is cached for it
+	Replaced EventType = "REPLACED"
 )
 
 type ContainerMeta struct {
@@ -19,10 +23,60 @@ type ResourceMeta struct {
 	ResourceVersion string
 	Status          string
 	ContainerNames  []ContainerMeta
+	Labels          map[string]string
+	// Fields are the fields that can be selected on besides the name and namespace, keyed like kubectl's
+	// field selectors, e.g. spec.nodeName
+	Fields    map[string]string
+	CreatedAt time.Time
+	// Pod is only set for pods
+	Pod *PodMeta
+	// Node is only set for nodes
+	Node *NodeMeta
 }
 
-type TypeMeta struct {
+// PodMeta is what's kept about a pod to tell it apart from the others named like it
+type PodMeta struct {
+	Owner *OwnerRef
+	Node  string
+	IP    string
+	// Ready is how many of the pod's Containers are running and ready
+	Ready      int
+	Containers int
+	// Restarts is the total of the restarts of the pod's containers
+	Restarts int32
+	// Images are the images of the init containers followed by those of the containers
+	Images []string
+}
+
+// NodeMeta is what tells a node's health and purpose, the details 'kubectl get nodes -o wide' and 'kubectl describe node' show
+type NodeMeta struct {
+	// Roles come from the node-role.kubernetes.io/<role> and kubernetes.io/role labels
+	Roles []string
+	// KubeletVersion is the version of the kubelet running on the node
+	KubeletVersion string
+	Unschedulable  bool
+	// Pressure lists the pressure conditions that are true, e.g. MemoryPressure
+	Pressure []string
+	// Taints are formatted as key=value:effect
+	Taints []string
+}
+
+// OwnerRef is the controller at the top of a resource's owners, e.g. the Deployment of a pod's ReplicaSet
+type OwnerRef struct {
 	Kind string
+	Name string
+}
+
+type TypeMeta struct {
+	Kind    string
+	Group   string
+	Version string
+}
+
+// QualifiedKind is the kind qualified by its group, e.g. certificate.cert-manager.io, which tells apart kinds of
+// different groups with the same name. The built-in kinds and those of the core group have no group to qualify them by
+func (t TypeMeta) QualifiedKind() string {
+	return qualify(t.Kind, t.Group)
 }
 
 type KubeResource struct {
@@ -30,9 +84,47 @@ type KubeResource struct {
 	ResourceMeta
 }
 
+// ResourceType describes a resource served by a cluster, as found through API discovery
+type ResourceType struct {
+	// Kind is the lower case singular name of the resource, which is used as the kind in the cache
+	Kind       string
+	Group      string
+	Version    string
+	Resource   string
+	ShortNames []string
+	Namespaced bool
+}
+
+// QualifiedKind is the kind qualified by its group, see TypeMeta.QualifiedKind
+func (rt ResourceType) QualifiedKind() string {
+	return qualify(rt.Kind, rt.Group)
+}
+
+// Aliases returns all the names the resource type can be referred to by, in the same way kubectl does
+func (rt ResourceType) Aliases() []string {
+	aliases := []string{rt.Kind, rt.Resource}
+	aliases = append(aliases, rt.ShortNames...)
+	if rt.Group != "" {
+		aliases = append(aliases, rt.Kind+"."+rt.Group, rt.Resource+"."+rt.Group)
+	}
+
+	return aliases
+}
+
+func qualify(kind, group string) string {
+	if group == "" {
+		return kind
+	}
+
+	return kind + "." + group
+}
+
 type ResourceEvent struct {
-	Type     EventType
-	Resource *KubeResource
+	Type      EventType
+	Resource  *KubeResource
+	Resources []KubeResource
+	// ResourceVersion is the resourceVersion a Replaced listing was taken at
+	ResourceVersion string
 }
 
 //******* Sorting functions *******
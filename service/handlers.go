@@ -0,0 +1,272 @@
+package service
+
+import (
+	"autocli/model"
+	"github.com/c-bata/go-prompt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"strings"
+)
+
+// handler is the KindHandler used for the built-in kinds and for resources found through discovery
+type handler struct {
+	name       string
+	kind       string
+	group      string
+	aliases    []string
+	namespaced bool
+	informer   func(factories InformerFactories) cache.SharedIndexInformer
+	convert    converter
+	options    func() []prompt.Suggest
+	// builds the kubectl arguments; if not set then 'kubectl <verb> <kind> <name>' is used
+	command func(context string, s Selection) []string
+}
+
+func init() {
+	RegisterKind(&handler{
+		name:       "pod",
+		kind:       "pod",
+		aliases:    []string{"pod", "p", "po"},
+		namespaced: true,
+		informer: func(f InformerFactories) cache.SharedIndexInformer {
+			return f.Typed.Core().V1().Pods().Informer()
+		},
+		convert: podToKubeResource,
+		options: getPodGetOptions,
+	})
+	RegisterKind(&handler{
+		name:       "log",
+		kind:       "pod",
+		aliases:    []string{"logs", "log", "lo", "l"},
+		namespaced: true,
+		options:    getLogOptions,
+		command: func(context string, s Selection) []string {
+			cmdArgs := []string{"logs", s.Name, "--namespace", s.Namespace}
+			cmdArgs = append(cmdArgs, s.Args...)
+			return append(cmdArgs, "--context", context)
+		},
+	})
+	RegisterKind(&handler{
+		name:    "node",
+		kind:    "node",
+		aliases: []string{"node", "no", "n"},
+		informer: func(f InformerFactories) cache.SharedIndexInformer {
+			return f.Typed.Core().V1().Nodes().Informer()
+		},
+		convert: nodeToKubeResource,
+		options: getNodeGetOptions,
+	})
+	RegisterKind(&handler{
+		name:       "deployment",
+		kind:       "deployment",
+		group:      "apps",
+		aliases:    []string{"deployment", "deploy"},
+		namespaced: true,
+		informer: func(f InformerFactories) cache.SharedIndexInformer {
+			return f.Typed.Apps().V1().Deployments().Informer()
+		},
+		convert: deploymentToKubeResource,
+		options: getDeploymentGetOptions,
+		command: func(context string, s Selection) []string {
+			if s.Verb == "rollout-status" {
+				return []string{"rollout", "status", "deployment/" + s.Name, "--namespace", s.Namespace, "--context", context}
+			}
+			return kubectlCommand(context, "deployment", s)
+		},
+	})
+	RegisterKind(&handler{
+		name:       "service",
+		kind:       "service",
+		aliases:    []string{"service", "svc"},
+		namespaced: true,
+		informer: func(f InformerFactories) cache.SharedIndexInformer {
+			return f.Typed.Core().V1().Services().Informer()
+		},
+		convert: serviceToKubeResource,
+		options: getEditableGetOptions,
+	})
+	RegisterKind(&handler{
+		name:       "configmap",
+		kind:       "configmap",
+		aliases:    []string{"configmap", "cm"},
+		namespaced: true,
+		informer: func(f InformerFactories) cache.SharedIndexInformer {
+			return f.Typed.Core().V1().ConfigMaps().Informer()
+		},
+		convert: configMapToKubeResource,
+		options: getEditableGetOptions,
+	})
+	RegisterKind(&handler{
+		name:    "namespace",
+		kind:    "namespace",
+		aliases: []string{"namespace", "ns"},
+		informer: func(f InformerFactories) cache.SharedIndexInformer {
+			return f.Typed.Core().V1().Namespaces().Informer()
+		},
+		convert: namespaceToKubeResource,
+		options: getNamespaceOptions,
+		command: func(context string, s Selection) []string {
+			// like kubens, selecting a namespace makes it the context's default unless something else was asked for
+			if s.Verb == "get" && len(s.Args) == 0 {
+				return []string{"config", "set-context", context, "--namespace", s.Name}
+			}
+			return kubectlCommand(context, "namespace", s)
+		},
+	})
+	RegisterKind(&handler{
+		name:       "ssh",
+		kind:       "pod",
+		aliases:    []string{"ssh"},
+		namespaced: true,
+		options:    getSSHOptions,
+		command: func(context string, s Selection) []string {
+			cmdArgs := []string{"exec", "-ti", s.Name, "--namespace", s.Namespace, "--context", context}
+			// check if a container has been specified, if so add that to the exec command
+			cmdArgs = append(cmdArgs, s.Args...)
+			// the shell command always needs to go last
+			return append(cmdArgs, "--", "sh")
+		},
+	})
+}
+
+// NewResourceTypeHandler creates the handler for a resource found through API discovery, which is
+// watched with the dynamic client. It isn't registered - the resource types differ between clusters
+func NewResourceTypeHandler(rt model.ResourceType) KindHandler {
+	// qualify the resource by its group when running kubectl, in case the name is ambiguous
+	kubectlKind := rt.Kind
+	if rt.Group != "" {
+		kubectlKind = rt.Kind + "." + rt.Group
+	}
+
+	return &handler{
+		name:       rt.Kind,
+		kind:       rt.Kind,
+		group:      rt.Group,
+		aliases:    rt.Aliases(),
+		namespaced: rt.Namespaced,
+		informer: func(f InformerFactories) cache.SharedIndexInformer {
+			if f.Dynamic == nil {
+				return nil
+			}
+			gvr := schema.GroupVersionResource{Group: rt.Group, Version: rt.Version, Resource: rt.Resource}
+			return f.Dynamic.ForResource(gvr).Informer()
+		},
+		convert: unstructuredConverter(rt),
+		options: getEditableGetOptions,
+		command: func(context string, s Selection) []string {
+			return kubectlCommand(context, kubectlKind, s)
+		},
+	}
+}
+
+func (h *handler) Name() string {
+	return h.name
+}
+
+func (h *handler) Kind() string {
+	return h.kind
+}
+
+func (h *handler) Group() string {
+	return h.group
+}
+
+func (h *handler) Aliases() []string {
+	return h.aliases
+}
+
+func (h *handler) Namespaced() bool {
+	return h.namespaced
+}
+
+func (h *handler) Informer(factories InformerFactories) cache.SharedIndexInformer {
+	if h.informer == nil {
+		return nil
+	}
+	return h.informer(factories)
+}
+
+func (h *handler) Convert(obj interface{}) (*model.KubeResource, bool) {
+	return h.convert(obj)
+}
+
+func (h *handler) Options() []prompt.Suggest {
+	return h.options()
+}
+
+func (h *handler) Command(context string, input []string) []string {
+	s := ParseSelection(input)
+	if h.command != nil {
+		return h.command(context, s)
+	}
+	return kubectlCommand(context, h.kind, s)
+}
+
+func getCommonGetOptions() []prompt.Suggest {
+	options := []prompt.Suggest{
+		{Text: "--output json", Description: "Output manifest in json format"},
+		{Text: "--output yaml", Description: "Output manifest in yaml format"},
+		{Text: "--output wide", Description: "Output more details"},
+		{Text: "--watch", Description: "After listing/getting the requested object, watch for changes"},
+		{Text: "@describe", Description: "Use kubectl describe instead of get on the resource"},
+	}
+
+	return options
+}
+
+func getPodGetOptions() []prompt.Suggest {
+	options := getCommonGetOptions()
+
+	return options
+}
+
+func getNodeGetOptions() []prompt.Suggest {
+	return getCommonGetOptions()
+}
+
+func getDeploymentGetOptions() []prompt.Suggest {
+	options := getCommonGetOptions()
+	options = append(options, prompt.Suggest{Text: "@rollout-status", Description: "Use kubectl rollout status to watch the rollout of the deployment"})
+
+	return options
+}
+
+func getEditableGetOptions() []prompt.Suggest {
+	options := getCommonGetOptions()
+	options = append(options, prompt.Suggest{Text: "@edit", Description: "Use kubectl edit instead of get on the resource"})
+
+	return options
+}
+
+func getNamespaceOptions() []prompt.Suggest {
+	options := getEditableGetOptions()
+	for i := range options {
+		// the options of get are only run as get when one of them is chosen, otherwise the namespace is switched to
+		if strings.HasPrefix(options[i].Text, "--") {
+			options[i].Description += ", rather than switching to the namespace"
+		}
+	}
+
+	return options
+}
+
+func getLogOptions() []prompt.Suggest {
+	options := []prompt.Suggest{
+		{Text: "--all-containers", Description: "Get all containers' logs in the pod"},
+		{Text: "--container", Description: "Get logs for specific container"},
+		{Text: "--follow", Description: "Specify if the logs should be streamed"},
+		{Text: "--prefix", Description: "Prefix each log line with the log source (pod name and container name)"},
+		{Text: "--previous", Description: "Print the logs for the previous instance of the container in a pod if it exists"},
+		{Text: "--timestamps", Description: "Include timestamps on each line in the log output"},
+	}
+
+	return options
+}
+
+func getSSHOptions() []prompt.Suggest {
+	options := []prompt.Suggest{
+		{Text: "--container", Description: "Get logs for specific container"},
+	}
+
+	return options
+}
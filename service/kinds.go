@@ -0,0 +1,161 @@
+package service
+
+import (
+	"autocli/model"
+	"fmt"
+	"github.com/c-bata/go-prompt"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"strings"
+	"sync"
+)
+
+// KindHandler holds everything kubectl-ac knows about one kind of resource: how to watch it, how to
+// turn it into a cache entry, what to offer at the prompt once one has been selected and how to build
+// the kubectl command for it.
+// A handler doesn't have to watch anything itself - 'log' and 'ssh' are different ways of using pods -
+// in which case Informer returns nil and Kind names the kind whose cache entries it selects from.
+type KindHandler interface {
+	// Name is what the handler is registered and shown at the prompt as, e.g. "log"
+	Name() string
+	// Kind is the kind of the cache entries the handler selects from, e.g. "pod"
+	Kind() string
+	// Group is the API group of the kind, blank for the core group
+	Group() string
+	// Aliases are the names the resources command can be called as to use the handler
+	Aliases() []string
+	Namespaced() bool
+	// Informer gets the informer for the kind from a context's informer factories, or nil if the handler doesn't watch anything
+	Informer(factories InformerFactories) cache.SharedIndexInformer
+	// Convert turns an object held by the informer into a cache entry; false means it wasn't of the expected type
+	Convert(obj interface{}) (*model.KubeResource, bool)
+	// Options are the follow up options suggested once a resource has been selected
+	Options() []prompt.Suggest
+	// Command builds the kubectl arguments from the text entered at the prompt
+	Command(context string, input []string) []string
+}
+
+// InformerFactories are the informer factories of a single context, handed to KindHandler.Informer
+type InformerFactories struct {
+	Typed   informers.SharedInformerFactory
+	Dynamic dynamicinformer.DynamicSharedInformerFactory
+}
+
+var (
+	registry      = make(map[string]KindHandler)
+	registryOrder []string
+	registryLock  = &sync.RWMutex{}
+)
+
+// RegisterKind makes a handler available to both the watch server and the resources command.
+// It panics if a handler with the same name or alias is already registered
+func RegisterKind(h KindHandler) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	for _, name := range append([]string{h.Name()}, h.Aliases()...) {
+		if _, exists := registry[name]; exists {
+			panic(fmt.Sprintf("kind handler already registered for %s", name))
+		}
+	}
+
+	registry[h.Name()] = h
+	for _, alias := range h.Aliases() {
+		registry[alias] = h
+	}
+	registryOrder = append(registryOrder, h.Name())
+}
+
+// KindHandlerFor looks up a handler by its name or one of its aliases
+func KindHandlerFor(name string) (KindHandler, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	h, ok := registry[name]
+	return h, ok
+}
+
+// KindHandlers returns all the registered handlers, in the order they were registered
+func KindHandlers() []KindHandler {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	handlers := make([]KindHandler, 0, len(registryOrder))
+	for _, name := range registryOrder {
+		handlers = append(handlers, registry[name])
+	}
+
+	return handlers
+}
+
+// the handler that watches a kind, if the kind is one of the registered ones
+func watchingHandlerFor(kind string) (KindHandler, bool) {
+	h, ok := KindHandlerFor(kind)
+	if !ok || h.Name() != kind || h.Kind() != kind {
+		return nil, false
+	}
+
+	return h, true
+}
+
+/*
+WatchedKind is the kind a resource type found through discovery is watched and cached as: the kind of the registered
+handler that watches the same resource, or else the kind qualified by its group. Kinds of different groups with the
+same name, e.g. Knative's service.serving.knative.dev and the core service, are then watched side by side
+*/
+func WatchedKind(rt model.ResourceType) string {
+	if h, ok := watchingHandlerFor(rt.Kind); ok && h.Group() == rt.Group {
+		return h.Kind()
+	}
+
+	return rt.QualifiedKind()
+}
+
+// Selection is the text entered at the prompt, split into its parts
+type Selection struct {
+	Name      string
+	Namespace string
+	// Verb is the kubectl verb chosen with one of the @ options, 'get' if none was
+	Verb string
+	Args []string
+}
+
+// ParseSelection splits the text entered at the prompt, e.g. "mypod [myns] --output yaml", into the
+// name, the namespace (only namespaced resources have one), the @ option and the remaining arguments
+func ParseSelection(input []string) Selection {
+	s := Selection{Verb: "get"}
+	if len(input) == 0 {
+		return s
+	}
+
+	s.Name = input[0]
+	for i, arg := range input[1:] {
+		switch {
+		case i == 0 && strings.HasPrefix(arg, "[") && strings.HasSuffix(arg, "]"):
+			s.Namespace = strings.TrimSuffix(strings.TrimPrefix(arg, "["), "]")
+		case strings.HasPrefix(arg, "@"):
+			s.Verb = strings.TrimPrefix(arg, "@")
+		default:
+			s.Args = append(s.Args, arg)
+		}
+	}
+
+	// the arguments only make sense for get, passing them to e.g. describe results in a kubectl error
+	if s.Verb != "get" {
+		s.Args = nil
+	}
+
+	return s
+}
+
+// Build the usual 'kubectl <verb> <kind> <name>' arguments for a selection
+func kubectlCommand(context, kind string, s Selection) []string {
+	cmdArgs := []string{s.Verb, kind, s.Name}
+	if s.Namespace != "" {
+		cmdArgs = append(cmdArgs, "--namespace", s.Namespace)
+	}
+	cmdArgs = append(cmdArgs, s.Args...)
+
+	return append(cmdArgs, "--context", context)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"autocli/model"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestKindHandlerCommand(t *testing.T) {
+	tests := []struct {
+		handler  string
+		input    string
+		expected string
+	}{
+		{handler: "pod", input: "mypod [myns]", expected: "get pod mypod --namespace myns --context ctx"},
+		{handler: "pod", input: "mypod [myns] --output yaml", expected: "get pod mypod --namespace myns --output yaml --context ctx"},
+		{handler: "pod", input: "mypod [myns] --output yaml @describe", expected: "describe pod mypod --namespace myns --context ctx"},
+		{handler: "node", input: "mynode @describe", expected: "describe node mynode --context ctx"},
+		{handler: "log", input: "mypod [myns] --follow", expected: "logs mypod --namespace myns --follow --context ctx"},
+		{handler: "ssh", input: "mypod [myns] --container app", expected: "exec -ti mypod --namespace myns --context ctx --container app -- sh"},
+		{handler: "deploy", input: "web [myns] @rollout-status", expected: "rollout status deployment/web --namespace myns --context ctx"},
+		{handler: "cm", input: "settings [myns] @edit", expected: "edit configmap settings --namespace myns --context ctx"},
+		{handler: "ns", input: "myns", expected: "config set-context ctx --namespace myns"},
+		{handler: "ns", input: "myns --output yaml", expected: "get namespace myns --output yaml --context ctx"},
+		{handler: "ns", input: "myns @describe", expected: "describe namespace myns --context ctx"},
+	}
+
+	for _, test := range tests {
+		h, ok := KindHandlerFor(test.handler)
+		if !ok {
+			t.Errorf("no handler registered for %s", test.handler)
+			continue
+		}
+		actual := h.Command("ctx", strings.Split(test.input, " "))
+		assert.Equal(t, test.expected, strings.Join(actual, " "), test.input)
+	}
+}
+
+func TestResourceTypeHandlerCommand(t *testing.T) {
+	h := NewResourceTypeHandler(model.ResourceType{Kind: "clusterissuer", Group: "cert-manager.io"})
+	actual := h.Command("ctx", []string{"letsencrypt", "@describe"})
+	assert.Equal(t, []string{"describe", "clusterissuer.cert-manager.io", "letsencrypt", "--context", "ctx"}, actual)
+}
+
+func TestWatchedKind(t *testing.T) {
+	tests := []struct {
+		rt       model.ResourceType
+		expected string
+	}{
+		{rt: model.ResourceType{Kind: "deployment", Group: "apps"}, expected: "deployment"},
+		{rt: model.ResourceType{Kind: "service"}, expected: "service"},
+		{rt: model.ResourceType{Kind: "service", Group: "serving.knative.dev"}, expected: "service.serving.knative.dev"},
+		{rt: model.ResourceType{Kind: "event"}, expected: "event"},
+		{rt: model.ResourceType{Kind: "event", Group: "events.k8s.io"}, expected: "event.events.k8s.io"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, WatchedKind(test.rt))
+	}
+}
+
+func TestRegisterKindTwice(t *testing.T) {
+	h, _ := KindHandlerFor("pod")
+	assert.Panics(t, func() { RegisterKind(h) })
+}
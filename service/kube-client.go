@@ -2,14 +2,27 @@ package service
 
 import (
 	"autocli/model"
-	"context"
+	"errors"
 	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/cache"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -17,148 +30,537 @@ import (
 type KubeClient interface {
 	Ping(context string) error
 	WatchResources(context, kind string, out chan *model.ResourceEvent) error
-	GetResources(context, kind string) ([]model.KubeResource, error)
+	ResolveKind(context, name string) (model.ResourceType, error)
+	// AddContext starts using the clients for a context. Discovery, e.g. to ping the server, goes through the
+	// discovery client if one is given, which should time out as the client's watches can't
+	AddContext(context string, client kubernetes.Interface, dynamicClient dynamic.Interface, discoveryClient discovery.DiscoveryInterface)
+	// SetNamespaces sets the namespaces of a context namespaced kinds are watched in, before any are watched
+	SetNamespaces(context string, namespaces Namespaces)
+	// ResumeFrom sets the resourceVersion the informers of a context first list at or after, before any are watched,
+	// so they don't go back past what was cached from an earlier watch of the context
+	ResumeFrom(context, resourceVersion string)
+	RemoveContext(context string)
 }
 
+// Namespaces are the namespaces of a context namespaced kinds are watched in
+type Namespaces struct {
+	// watched one by one; if there are none namespaced kinds are watched across the cluster
+	Watch []string
+	// watched instead if watching across the cluster is forbidden, blank to keep trying across the cluster
+	Fallback string
+}
+
+// how often the informers re-deliver every cached object
+const defaultResyncPeriod = 10 * time.Minute
+
+// how often waiting for the informers to sync checks on them, the same as cache.WaitForCacheSync
+const syncPollPeriod = 100 * time.Millisecond
+
+// how long after a CronJob's Job was scheduled its pods are taken to be created, retries included
+const cronJobPodWindow = 24 * time.Hour
+
 type DefaultKubeClient struct {
-	clients map[string]kubernetes.Interface
+	clients          map[string]kubernetes.Interface
+	dynamicClients   map[string]dynamic.Interface
+	discoveryClients map[string]discovery.DiscoveryInterface
+	namespaces       map[string]Namespaces
+	resourceVersions map[string]string
+	informers        map[string]*contextInformers
+	// the resource types names have been resolved to, keyed by context and by the kind they're watched as,
+	// so a kind isn't resolved again to another group's resource of the same name
+	resourceTypes map[string]map[string]model.ResourceType
+	mu            *sync.Mutex
 }
 
-func (d *DefaultKubeClient) Ping(ctx string) error {
-	client, ok := d.clients[ctx]
-	if !ok {
-		return fmt.Errorf("context not found: %s", ctx)
-	}
-	nodes, err := client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+// The informer factories for a single context. Cluster-scoped kinds are watched across the cluster and
+// namespaced kinds in each of the context's namespaces, or across the cluster if it has none
+type contextInformers struct {
+	cluster InformerFactories
+	// keyed by namespace, metav1.NamespaceAll for across the cluster
+	namespaced map[string]InformerFactories
+	// the namespace to fall back to if watching namespaced kinds across the cluster is forbidden
+	fallback string
+	// closed to stop the namespaced informers when falling back, and replaced for the new ones
+	nsStopCh chan struct{}
+	stopCh   chan struct{}
+	// the informers WatchResources has added its event handler to, which they keep for as long as they run
+	handled map[cache.SharedIndexInformer]bool
+	// the informers whose watch is forbidden, with the error; waiting for them to sync gives up with it
+	forbidden map[cache.SharedIndexInformer]error
+	// the resourceVersion the informers first list at or after, blank once a list or watch of the context has failed
+	resumeFrom string
+}
+
+// converter turns an object held by an informer into a KubeResource; false means the object wasn't of the expected type
+type converter func(obj interface{}) (*model.KubeResource, bool)
 
+func (d *DefaultKubeClient) Ping(ctx string) error {
+	dc, err := d.discoveryFor(ctx)
 	if err != nil {
 		return err
 	}
-	log.Debugf("Nodes: %s", nodes)
-	if len(nodes.Items) < 1 {
-		return fmt.Errorf("no nodes available for context: %s", ctx)
+	// asking for the version works for any user that can reach the server, unlike listing nodes which RBAC
+	// or a virtual cluster may not allow
+	version, err := dc.ServerVersion()
+	if err != nil {
+		return err
 	}
+	log.Debugf("Server version: %s", version)
 
 	return nil
 }
 
 func (d *DefaultKubeClient) WatchResources(context, kind string, out chan *model.ResourceEvent) error {
-	client, ok := d.clients[context]
-	if !ok {
-		return fmt.Errorf("context not found: %s", context)
+	for {
+		infs, convert, ci, stop, err := d.informersFor(context, kind)
+		if err != nil {
+			return err
+		}
+
+		for _, informer := range d.withoutHandler(ci, infs) {
+			informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					if res, ok := convert(obj); ok {
+						send(ci, out, &model.ResourceEvent{Type: model.Added, Resource: res})
+					}
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					if res, ok := convert(newObj); ok {
+						send(ci, out, &model.ResourceEvent{Type: model.Modified, Resource: res})
+					}
+				},
+				DeleteFunc: func(obj interface{}) {
+					// the informer hands over a tombstone if the delete was missed while the watch was down
+					if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+						obj = tombstone.Obj
+					}
+					if res, ok := convert(obj); ok {
+						send(ci, out, &model.ResourceEvent{Type: model.Deleted, Resource: res})
+					}
+				},
+			})
+		}
+
+		if err := d.syncInformers(ci, infs, stop); err != nil {
+			if isClosed(stop) && !isClosed(ci.stopCh) {
+				// the namespaces changed while syncing, watch the new ones
+				continue
+			}
+			return fmt.Errorf("watching %s failed: %s", kind, err)
+		}
+
+		// hand over the full listing so that anything cached before the informers started gets swapped out
+		// in one go; from here on the informers relist and resume from the last resourceVersion by themselves
+		send(ci, out, &model.ResourceEvent{
+			Type:            model.Replaced,
+			Resources:       listInformers(infs, convert),
+			ResourceVersion: infs[len(infs)-1].LastSyncResourceVersion(),
+		})
+
+		select {
+		case <-ci.stopCh:
+			return nil
+		case <-stop:
+			if isClosed(ci.stopCh) {
+				return nil
+			}
+			log.WithField("context", context).WithField("kind", kind).Info("namespaces have changed, restarting watch")
+		}
+	}
+}
+
+// Resolve a resource name the same way kubectl does - plural, singular, short name, optionally qualified by
+// its group (e.g. certificates.cert-manager.io) - using the API discovery of the specified context.
+// The server's preferred version of the group is used
+func (d *DefaultKubeClient) ResolveKind(ctx, name string) (model.ResourceType, error) {
+	dc, err := d.discoveryFor(ctx)
+	if err != nil {
+		return model.ResourceType{}, err
 	}
 
-	switch kind {
-	case "pod":
-		ch, err := d.watchPods(client, v1.NamespaceAll)
+	// discovery can partially fail (e.g. a broken aggregated API) - anything that was found is still usable
+	groups, lists, err := dc.ServerGroupsAndResources()
+	if err != nil && len(lists) == 0 {
+		return model.ResourceType{}, fmt.Errorf("discovery failed for context %s: %s", ctx, err)
+	}
+
+	preferred := make(map[string]bool)
+	for _, g := range groups {
+		preferred[g.PreferredVersion.GroupVersion] = true
+	}
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	var matches []model.ResourceType
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
 		if err != nil {
-			return fmt.Errorf("watching pods failed: %s", err)
-		}
-		for event := range ch {
-			pod, ok := event.Object.(*v1.Pod)
-			if !ok {
-				return fmt.Errorf("unexpected type: %s", pod)
-			}
-			var evt model.ResourceEvent
-			log.Debug(event.Type)
-			switch event.Type {
-			case watch.Added:
-				evt.Type = model.Added
-			case watch.Deleted:
-				evt.Type = model.Deleted
-			case watch.Modified:
-				evt.Type = model.Modified
-			}
-			var status string
-			var cNames []model.ContainerMeta
-			if strings.TrimSpace(pod.Status.Message) == "" {
-				status = string(pod.Status.Phase)
-			} else {
-				status = fmt.Sprintf("%s: %s", pod.Status.Phase, pod.Status.Message)
+			continue
+		}
+		for _, r := range list.APIResources {
+			// skip subresources (e.g. pods/log) and anything that can't be watched
+			if strings.Contains(r.Name, "/") || !hasVerbs(r.Verbs, "list", "watch") {
+				continue
 			}
-
-			//get all the container names (including init ones if there are any)
-			if len(pod.Spec.InitContainers) > 0 {
-				for _, c := range pod.Spec.InitContainers {
-					cNames = append(cNames, model.ContainerMeta{
-						Name: c.Name,
-						Type: "Init Container",
-					})
+			kind := r.SingularName
+			if kind == "" {
+				kind = strings.ToLower(r.Kind)
+			}
+			rt := model.ResourceType{
+				Kind:       kind,
+				Group:      gv.Group,
+				Version:    gv.Version,
+				Resource:   r.Name,
+				ShortNames: r.ShortNames,
+				Namespaced: r.Namespaced,
+			}
+			for _, alias := range rt.Aliases() {
+				if alias == name {
+					if preferred[list.GroupVersion] {
+						return d.resolved(ctx, rt), nil
+					}
+					matches = append(matches, rt)
+					break
 				}
 			}
-			for _, c := range pod.Spec.Containers {
-				cNames = append(cNames, model.ContainerMeta{
-					Name: c.Name,
-					Type: "Container",
-				})
-			}
-
-			evt.Resource = &model.KubeResource{
-				TypeMeta: model.TypeMeta{Kind: "pod"},
-				ResourceMeta: model.ResourceMeta{
-					Name:            pod.Name,
-					Namespace:       pod.Namespace,
-					ResourceVersion: pod.ResourceVersion,
-					Status:          status,
-					ContainerNames:  cNames,
-				},
+		}
+	}
+
+	if len(matches) == 0 {
+		return model.ResourceType{}, fmt.Errorf("the server doesn't have a resource type %q in context %s", name, ctx)
+	}
+
+	return d.resolved(ctx, matches[0]), nil
+}
+
+// Record the resource type a name has been resolved to under the kind it's watched as
+func (d *DefaultKubeClient) resolved(ctx string, rt model.ResourceType) model.ResourceType {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.resourceTypes[ctx]; !ok {
+		d.resourceTypes[ctx] = make(map[string]model.ResourceType)
+	}
+	d.resourceTypes[ctx][WatchedKind(rt)] = rt
+
+	return rt
+}
+
+// Start using the clients for a context. A context that's already known keeps its existing clients
+func (d *DefaultKubeClient) AddContext(ctx string, client kubernetes.Interface, dynamicClient dynamic.Interface, discoveryClient discovery.DiscoveryInterface) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.clients[ctx]; ok {
+		return
+	}
+	d.clients[ctx] = client
+	if dynamicClient != nil {
+		d.dynamicClients[ctx] = dynamicClient
+	}
+	if discoveryClient != nil {
+		d.discoveryClients[ctx] = discoveryClient
+	}
+}
+
+// The discovery client of a context, or else the one of its clientset
+func (d *DefaultKubeClient) discoveryFor(ctx string) (discovery.DiscoveryInterface, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if dc, ok := d.discoveryClients[ctx]; ok {
+		return dc, nil
+	}
+	client, ok := d.clients[ctx]
+	if !ok {
+		return nil, fmt.Errorf("context not found: %s", ctx)
+	}
+
+	return client.Discovery(), nil
+}
+
+func (d *DefaultKubeClient) SetNamespaces(ctx string, namespaces Namespaces) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.namespaces[ctx] = namespaces
+}
+
+func (d *DefaultKubeClient) ResumeFrom(ctx string, resourceVersion string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.resourceVersions[ctx] = resourceVersion
+}
+
+// Stop the informers of a context and forget its clients; any WatchResources call for it returns
+func (d *DefaultKubeClient) RemoveContext(ctx string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ci, ok := d.informers[ctx]; ok {
+		close(ci.nsStopCh)
+		close(ci.stopCh)
+		delete(d.informers, ctx)
+	}
+	delete(d.clients, ctx)
+	delete(d.dynamicClients, ctx)
+	delete(d.discoveryClients, ctx)
+	delete(d.namespaces, ctx)
+	delete(d.resourceVersions, ctx)
+	delete(d.resourceTypes, ctx)
+}
+
+/*
+Get the informers (and the function to convert the objects they hold) for a kind in the specified context, along
+with the channel that stops them: one informer across the cluster for cluster-scoped kinds and one per namespace
+for namespaced kinds. Kinds without a registered handler are watched with the dynamic client, as the resource type
+the kind was resolved to through API discovery - or else the one it resolves to now
+*/
+func (d *DefaultKubeClient) informersFor(ctx, kind string) ([]cache.SharedIndexInformer, converter, *contextInformers, chan struct{}, error) {
+	h, ok := watchingHandlerFor(kind)
+	if !ok {
+		d.mu.Lock()
+		rt, resolved := d.resourceTypes[ctx][kind]
+		d.mu.Unlock()
+		if !resolved {
+			var err error
+			if rt, err = d.ResolveKind(ctx, kind); err != nil {
+				return nil, nil, nil, nil, err
 			}
-			out <- &evt
 		}
-	default:
-		return fmt.Errorf("unsupported kind: %s", kind)
+		h = NewResourceTypeHandler(rt)
 	}
 
-	return nil
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ci, err := d.contextInformers(ctx)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	factories := map[string]InformerFactories{metav1.NamespaceAll: ci.cluster}
+	stop := ci.stopCh
+	if h.Namespaced() {
+		factories = ci.namespaced
+		stop = ci.nsStopCh
+	}
+
+	namespaces := make([]string, 0, len(factories))
+	for ns := range factories {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	infs := []cache.SharedIndexInformer{}
+	for _, ns := range namespaces {
+		informer := h.Informer(factories[ns])
+		if informer == nil {
+			return nil, nil, nil, nil, fmt.Errorf("unsupported kind: %s", kind)
+		}
+		// fails if the informer is already running, in which case it already has the handler
+		informer.SetWatchErrorHandler(d.onWatchError(ctx, ci, informer, stop))
+		infs = append(infs, informer)
+	}
+
+	return infs, h.Convert, ci, stop, nil
 }
 
-func (d *DefaultKubeClient) GetResources(ctx, kind string) ([]model.KubeResource, error) {
-	var resources []model.KubeResource
+// The informers that don't have WatchResources' event handler yet, which are marked as having it. An event handler
+// can't be removed from an informer, so adding it again when a watch is retried would apply every event once more
+func (d *DefaultKubeClient) withoutHandler(ci *contextInformers, infs []cache.SharedIndexInformer) []cache.SharedIndexInformer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	unhandled := []cache.SharedIndexInformer{}
+	for _, informer := range infs {
+		if !ci.handled[informer] {
+			ci.handled[informer] = true
+			unhandled = append(unhandled, informer)
+		}
+	}
 
+	return unhandled
+}
+
+// Get the informer factories for a context, creating them on first use. The caller must hold the lock
+func (d *DefaultKubeClient) contextInformers(ctx string) (*contextInformers, error) {
 	client, ok := d.clients[ctx]
 	if !ok {
-		return []model.KubeResource{}, fmt.Errorf("context not found: %s", ctx)
+		return nil, fmt.Errorf("context not found: %s", ctx)
 	}
 
-	switch kind {
-	case "node":
-		nodes, err := d.getNodes(client)
-		if err != nil {
-			return []model.KubeResource{}, err
+	ci, ok := d.informers[ctx]
+	if !ok {
+		ci = &contextInformers{
+			nsStopCh:   make(chan struct{}),
+			stopCh:     make(chan struct{}),
+			handled:    make(map[cache.SharedIndexInformer]bool),
+			forbidden:  make(map[cache.SharedIndexInformer]error),
+			resumeFrom: d.resourceVersions[ctx],
 		}
-		log.Debug(nodes)
-		for _, node := range nodes.Items {
-			AddToKubeResources(&resources, "node", node.Name, node.Namespace, node.ResourceVersion, determineNodeStatus(node.Status.Conditions))
+		ci.cluster = d.newFactories(ctx, client, ci, metav1.NamespaceAll)
+		namespaces := d.namespaces[ctx]
+		ci.namespaced = make(map[string]InformerFactories)
+		for _, ns := range namespaces.Watch {
+			ci.namespaced[ns] = d.newFactories(ctx, client, ci, ns)
 		}
-		return resources, nil
-	default:
-		return []model.KubeResource{}, fmt.Errorf("unsupported kind: %s", kind)
+		if len(ci.namespaced) == 0 {
+			ci.namespaced[metav1.NamespaceAll] = d.newFactories(ctx, client, ci, metav1.NamespaceAll)
+			ci.fallback = namespaces.Fallback
+		}
+		d.informers[ctx] = ci
 	}
+
+	return ci, nil
 }
 
-func (d *DefaultKubeClient) watchPods(client kubernetes.Interface, ns string) (out <-chan watch.Event, err error) {
-	req, err := client.CoreV1().Pods(ns).Watch(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return nil, err
+// Create the informer factories for a namespace of a context. The caller must hold the lock
+func (d *DefaultKubeClient) newFactories(ctx string, client kubernetes.Interface, ci *contextInformers, namespace string) InformerFactories {
+	tweak := d.tweakListOptions(ci)
+	f := InformerFactories{
+		Typed: informers.NewSharedInformerFactoryWithOptions(client, defaultResyncPeriod, informers.WithNamespace(namespace), informers.WithTweakListOptions(tweak)),
+	}
+	if dc, ok := d.dynamicClients[ctx]; ok {
+		f.Dynamic = dynamicinformer.NewFilteredDynamicSharedInformerFactory(dc, defaultResyncPeriod, namespace, tweak)
 	}
-	return req.ResultChan(), nil
+
+	return f
 }
 
-func (d *DefaultKubeClient) getNodes(client kubernetes.Interface) (*v1.NodeList, error) {
-	return client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+/*
+The list options of a context's informers. Until an informer has listed once the reflector asks for any
+resourceVersion, which the API server may serve from a watch cache that's behind; the context's informers ask for
+the one they resume from or later instead, so nothing older than what was already cached comes back. That list isn't
+paginated, as the reflector does itself for a resourceVersion, so it's still served from the watch cache
+*/
+func (d *DefaultKubeClient) tweakListOptions(ci *contextInformers) func(options *metav1.ListOptions) {
+	return func(options *metav1.ListOptions) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		if options.ResourceVersion == "0" && ci.resumeFrom != "" {
+			options.ResourceVersion = ci.resumeFrom
+			options.Limit = 0
+		}
+	}
+}
+
+/*
+An informer's watch error handler for when watching is forbidden. Namespaced kinds watched across the cluster fall
+back to the context's fallback namespace, e.g. because RBAC only allows a few namespaces; otherwise the error is
+recorded so waiting for the informer to sync gives up with it, e.g. for nodes that RBAC doesn't allow to be listed
+*/
+func (d *DefaultKubeClient) onWatchError(ctx string, ci *contextInformers, informer cache.SharedIndexInformer, stop chan struct{}) cache.WatchErrorHandler {
+	return func(r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(r, err)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		// the resourceVersion may be too old or new for the API server, e.g. if the cluster was rebuilt, so the
+		// retry asks for any resourceVersion as it would have in the first place
+		ci.resumeFrom = ""
+		if !isForbidden(err) {
+			return
+		}
+
+		// the informers may have been stopped
+		if d.informers[ctx] != ci {
+			return
+		}
+		// another informer may have already fallen back, or there's nothing to fall back to
+		if ci.nsStopCh != stop || ci.fallback == "" {
+			ci.forbidden[informer] = err
+			return
+		}
+		l := log.WithField("context", ctx).WithField("namespace", ci.fallback)
+		l.WithField("error", err).Warn("watching across the cluster is forbidden, falling back to the namespace")
+		close(ci.nsStopCh)
+		ci.nsStopCh = make(chan struct{})
+		ci.namespaced = map[string]InformerFactories{ci.fallback: d.newFactories(ctx, d.clients[ctx], ci, ci.fallback)}
+		ci.fallback = ""
+	}
+}
+
+// The reflector only passes on the message of the error from the API server, not its status
+func isForbidden(err error) bool {
+	return apierrors.IsForbidden(err) || strings.Contains(err.Error(), "is forbidden")
+}
+
+// Start any informers of the context that aren't running yet and wait for the informers to complete their
+// initial list, for one of them to be forbidden from listing or for the channel that stops them to be closed
+func (d *DefaultKubeClient) syncInformers(ci *contextInformers, infs []cache.SharedIndexInformer, stop chan struct{}) error {
+	d.mu.Lock()
+	start(ci.cluster, ci.stopCh)
+	for _, f := range ci.namespaced {
+		start(f, ci.nsStopCh)
+	}
+	d.mu.Unlock()
+
+	err := wait.PollImmediateUntil(syncPollPeriod, func() (bool, error) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		synced := true
+		for _, informer := range infs {
+			if informer.HasSynced() {
+				continue
+			}
+			if err, ok := ci.forbidden[informer]; ok {
+				return false, err
+			}
+			synced = false
+		}
+		return synced, nil
+	}, stop)
+	if err == wait.ErrWaitTimeout {
+		return errors.New("failed to sync cache")
+	}
+
+	return err
+}
+
+func start(f InformerFactories, stop chan struct{}) {
+	f.Typed.Start(stop)
+	if f.Dynamic != nil {
+		f.Dynamic.Start(stop)
+	}
 }
 
-func (d *DefaultKubeClient) getConfigMaps(client kubernetes.Interface, ns string) (*v1.ConfigMapList, error) {
-	return client.CoreV1().ConfigMaps(ns).List(context.TODO(), metav1.ListOptions{})
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
 }
 
-func (d *DefaultKubeClient) getServices(client kubernetes.Interface, ns string) (*v1.ServiceList, error) {
-	return client.CoreV1().Services(ns).List(context.TODO(), metav1.ListOptions{})
+// Hand an event over unless the context's informers have been stopped, in which case nobody is listening any more
+func send(ci *contextInformers, out chan *model.ResourceEvent, evt *model.ResourceEvent) {
+	select {
+	case out <- evt:
+	case <-ci.stopCh:
+	}
 }
 
-func NewKubeClient(clients map[string]kubernetes.Interface) KubeClient {
+func NewKubeClient(clients map[string]kubernetes.Interface, dynamicClients map[string]dynamic.Interface) KubeClient {
+	if clients == nil {
+		clients = make(map[string]kubernetes.Interface)
+	}
+	if dynamicClients == nil {
+		dynamicClients = make(map[string]dynamic.Interface)
+	}
 	dkc := &DefaultKubeClient{
-		clients: clients,
+		clients:          clients,
+		dynamicClients:   dynamicClients,
+		discoveryClients: make(map[string]discovery.DiscoveryInterface),
+		namespaces:       make(map[string]Namespaces),
+		resourceVersions: make(map[string]string),
+		informers:        make(map[string]*contextInformers),
+		resourceTypes:    make(map[string]map[string]model.ResourceType),
+		mu:               &sync.Mutex{},
 	}
 
 	return dkc
@@ -180,16 +582,414 @@ func AddToKubeResources(resourcesPtr *[]model.KubeResource, tm, name, ns, rv, st
 	})
 }
 
-func determineNodeStatus(conditions []v1.NodeCondition) string {
+// The status of a node as 'kubectl get nodes' shows it, e.g. Ready,SchedulingDisabled for a cordoned node
+func determineNodeStatus(node *v1.Node) string {
 	var status = "Unknown"
-	for _, v := range conditions {
+	for _, v := range node.Status.Conditions {
 		if v.Type == v1.NodeReady {
 			if v.Status == v1.ConditionTrue {
 				status = "Ready"
-				break
+			} else {
+				status = "NotReady"
 			}
+			break
 		}
 	}
+	if node.Spec.Unschedulable {
+		status += ",SchedulingDisabled"
+	}
 
 	return status
 }
+
+func nodeMeta(node *v1.Node) *model.NodeMeta {
+	meta := &model.NodeMeta{
+		Roles:          nodeRoles(node.Labels),
+		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+		Unschedulable:  node.Spec.Unschedulable,
+	}
+	for _, c := range node.Status.Conditions {
+		switch c.Type {
+		case v1.NodeMemoryPressure, v1.NodeDiskPressure, v1.NodePIDPressure:
+			if c.Status == v1.ConditionTrue {
+				meta.Pressure = append(meta.Pressure, string(c.Type))
+			}
+		}
+	}
+	for _, t := range node.Spec.Taints {
+		taint := t.Key
+		if t.Value != "" {
+			taint += "=" + t.Value
+		}
+		meta.Taints = append(meta.Taints, fmt.Sprintf("%s:%s", taint, t.Effect))
+	}
+
+	return meta
+}
+
+// Find the roles of a node from its labels, the same way kubectl does
+func nodeRoles(labels map[string]string) []string {
+	var roles []string
+	for k, v := range labels {
+		switch {
+		case strings.HasPrefix(k, "node-role.kubernetes.io/"):
+			if role := strings.TrimPrefix(k, "node-role.kubernetes.io/"); role != "" {
+				roles = append(roles, role)
+			}
+		case k == "kubernetes.io/role" && v != "":
+			roles = append(roles, v)
+		}
+	}
+	sort.Strings(roles)
+
+	return roles
+}
+
+// The objects held by the informers, e.g. one for each namespace of a kind
+func listInformers(infs []cache.SharedIndexInformer, convert converter) []model.KubeResource {
+	resources := []model.KubeResource{}
+	for _, informer := range infs {
+		for _, obj := range informer.GetStore().List() {
+			if res, ok := convert(obj); ok {
+				resources = append(resources, *res)
+			}
+		}
+	}
+	sort.Sort(model.ByKindNSName(resources))
+
+	return resources
+}
+
+// Objects watched through the dynamic client are all converted the same way, using the resource type they were resolved to
+func unstructuredConverter(rt model.ResourceType) converter {
+	return func(obj interface{}) (*model.KubeResource, bool) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			log.Errorf("unexpected type: %T", obj)
+			return nil, false
+		}
+
+		return &model.KubeResource{
+			TypeMeta: model.TypeMeta{Kind: rt.Kind, Group: rt.Group, Version: rt.Version},
+			ResourceMeta: model.ResourceMeta{
+				Name:            u.GetName(),
+				Namespace:       u.GetNamespace(),
+				ResourceVersion: u.GetResourceVersion(),
+				Status:          determineGenericStatus(u),
+				Labels:          u.GetLabels(),
+				CreatedAt:       u.GetCreationTimestamp().Time,
+			},
+		}, true
+	}
+}
+
+/*
+The status of a pod as 'kubectl get pods' shows it, along with how many of its containers are ready and
+how many times they've restarted: the reason a container is waiting or terminated (e.g. CrashLoopBackOff)
+takes over from the pod's phase, as does the progress of its init containers and its deletion.
+*/
+func podStatus(pod *v1.Pod) (status string, ready int, restarts int32) {
+	status = string(pod.Status.Phase)
+	if pod.Status.Reason != "" {
+		status = pod.Status.Reason
+	}
+
+	initializing := false
+	for i, c := range pod.Status.InitContainerStatuses {
+		restarts += c.RestartCount
+		switch {
+		case c.State.Terminated != nil && c.State.Terminated.ExitCode == 0:
+			continue
+		case c.State.Terminated != nil:
+			if c.State.Terminated.Reason != "" {
+				status = "Init:" + c.State.Terminated.Reason
+			} else if c.State.Terminated.Signal != 0 {
+				status = fmt.Sprintf("Init:Signal:%d", c.State.Terminated.Signal)
+			} else {
+				status = fmt.Sprintf("Init:ExitCode:%d", c.State.Terminated.ExitCode)
+			}
+		case c.State.Waiting != nil && c.State.Waiting.Reason != "" && c.State.Waiting.Reason != "PodInitializing":
+			status = "Init:" + c.State.Waiting.Reason
+		default:
+			status = fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers))
+		}
+		initializing = true
+		break
+	}
+
+	if !initializing {
+		restarts = 0
+		running := false
+		for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			c := pod.Status.ContainerStatuses[i]
+			restarts += c.RestartCount
+			switch {
+			case c.State.Waiting != nil && c.State.Waiting.Reason != "":
+				status = c.State.Waiting.Reason
+			case c.State.Terminated != nil && c.State.Terminated.Reason != "":
+				status = c.State.Terminated.Reason
+			case c.State.Terminated != nil && c.State.Terminated.Signal != 0:
+				status = fmt.Sprintf("Signal:%d", c.State.Terminated.Signal)
+			case c.State.Terminated != nil:
+				status = fmt.Sprintf("ExitCode:%d", c.State.Terminated.ExitCode)
+			case c.Ready && c.State.Running != nil:
+				running = true
+				ready++
+			}
+		}
+
+		// a container that has completed doesn't make a pod with other containers still running complete
+		if status == "Completed" && running {
+			status = "NotReady"
+			for _, cond := range pod.Status.Conditions {
+				if cond.Type == v1.PodReady && cond.Status == v1.ConditionTrue {
+					status = "Running"
+				}
+			}
+		}
+	}
+
+	if pod.DeletionTimestamp != nil {
+		if pod.Status.Reason == "NodeLost" {
+			status = "Unknown"
+		} else {
+			status = "Terminating"
+		}
+	}
+
+	return status, ready, restarts
+}
+
+func podToKubeResource(obj interface{}) (*model.KubeResource, bool) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		log.Errorf("unexpected type: %T", obj)
+		return nil, false
+	}
+
+	var cNames []model.ContainerMeta
+	var images []string
+	status, ready, restarts := podStatus(pod)
+
+	//get all the container names (including init ones if there are any)
+	if len(pod.Spec.InitContainers) > 0 {
+		for _, c := range pod.Spec.InitContainers {
+			cNames = append(cNames, model.ContainerMeta{
+				Name: c.Name,
+				Type: "Init Container",
+			})
+			images = append(images, c.Image)
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		cNames = append(cNames, model.ContainerMeta{
+			Name: c.Name,
+			Type: "Container",
+		})
+		images = append(images, c.Image)
+	}
+
+	return &model.KubeResource{
+		TypeMeta: model.TypeMeta{Kind: "pod"},
+		ResourceMeta: model.ResourceMeta{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			ResourceVersion: pod.ResourceVersion,
+			Status:          status,
+			ContainerNames:  cNames,
+			Labels:          pod.Labels,
+			Fields: map[string]string{
+				"spec.nodeName": pod.Spec.NodeName,
+				"status.phase":  string(pod.Status.Phase),
+			},
+			CreatedAt: pod.CreationTimestamp.Time,
+			Pod: &model.PodMeta{
+				Owner:      podOwner(pod),
+				Node:       pod.Spec.NodeName,
+				IP:         pod.Status.PodIP,
+				Ready:      ready,
+				Containers: len(pod.Spec.Containers),
+				Restarts:   restarts,
+				Images:     images,
+			},
+		},
+	}, true
+}
+
+/*
+The controller at the top of the pod's owners, found without looking up the pod's owner:
+  - the ReplicaSets of a Deployment are named after it followed by the pod-template-hash their pods are labelled with
+  - the Jobs of a CronJob are named after it followed by the minute they were scheduled for, since the Unix epoch,
+    which is shortly before their pods are created
+*/
+func podOwner(pod *v1.Pod) *model.OwnerRef {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil
+	}
+	switch ref.Kind {
+	case "ReplicaSet":
+		suffix := "-" + pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if suffix != "-" && strings.HasSuffix(ref.Name, suffix) {
+			return &model.OwnerRef{Kind: "Deployment", Name: strings.TrimSuffix(ref.Name, suffix)}
+		}
+	case "Job":
+		i := strings.LastIndex(ref.Name, "-")
+		if i <= 0 {
+			break
+		}
+		minutes, err := strconv.ParseInt(ref.Name[i+1:], 10, 64)
+		if err != nil {
+			break
+		}
+		// a Job that merely ends in a number, e.g. migrate-2, wasn't scheduled shortly before its pods
+		sinceScheduled := pod.CreationTimestamp.Sub(time.Unix(minutes*60, 0))
+		if sinceScheduled >= 0 && sinceScheduled < cronJobPodWindow {
+			return &model.OwnerRef{Kind: "CronJob", Name: ref.Name[:i]}
+		}
+	}
+
+	return &model.OwnerRef{Kind: ref.Kind, Name: ref.Name}
+}
+
+func deploymentToKubeResource(obj interface{}) (*model.KubeResource, bool) {
+	deploy, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		log.Errorf("unexpected type: %T", obj)
+		return nil, false
+	}
+
+	var resources []model.KubeResource
+	AddToKubeResources(&resources, "deployment", deploy.Name, deploy.Namespace, deploy.ResourceVersion, determineDeploymentStatus(deploy))
+	resources[0].Labels = deploy.Labels
+	resources[0].CreatedAt = deploy.CreationTimestamp.Time
+	return &resources[0], true
+}
+
+func serviceToKubeResource(obj interface{}) (*model.KubeResource, bool) {
+	svc, ok := obj.(*v1.Service)
+	if !ok {
+		log.Errorf("unexpected type: %T", obj)
+		return nil, false
+	}
+
+	var resources []model.KubeResource
+	AddToKubeResources(&resources, "service", svc.Name, svc.Namespace, svc.ResourceVersion, determineServiceStatus(svc))
+	resources[0].Labels = svc.Labels
+	resources[0].CreatedAt = svc.CreationTimestamp.Time
+	return &resources[0], true
+}
+
+func configMapToKubeResource(obj interface{}) (*model.KubeResource, bool) {
+	cm, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		log.Errorf("unexpected type: %T", obj)
+		return nil, false
+	}
+
+	keys := len(cm.Data) + len(cm.BinaryData)
+	var resources []model.KubeResource
+	AddToKubeResources(&resources, "configmap", cm.Name, cm.Namespace, cm.ResourceVersion, fmt.Sprintf("%d keys", keys))
+	resources[0].Labels = cm.Labels
+	resources[0].CreatedAt = cm.CreationTimestamp.Time
+	return &resources[0], true
+}
+
+func namespaceToKubeResource(obj interface{}) (*model.KubeResource, bool) {
+	ns, ok := obj.(*v1.Namespace)
+	if !ok {
+		log.Errorf("unexpected type: %T", obj)
+		return nil, false
+	}
+
+	var resources []model.KubeResource
+	AddToKubeResources(&resources, "namespace", ns.Name, "", ns.ResourceVersion, string(ns.Status.Phase))
+	resources[0].Labels = ns.Labels
+	resources[0].CreatedAt = ns.CreationTimestamp.Time
+	return &resources[0], true
+}
+
+func nodeToKubeResource(obj interface{}) (*model.KubeResource, bool) {
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		log.Errorf("unexpected type: %T", obj)
+		return nil, false
+	}
+
+	var resources []model.KubeResource
+	AddToKubeResources(&resources, "node", node.Name, node.Namespace, node.ResourceVersion, determineNodeStatus(node))
+	resources[0].Labels = node.Labels
+	resources[0].CreatedAt = node.CreationTimestamp.Time
+	resources[0].Fields = map[string]string{"spec.unschedulable": strconv.FormatBool(node.Spec.Unschedulable)}
+	resources[0].Node = nodeMeta(node)
+	return &resources[0], true
+}
+
+func determineDeploymentStatus(deploy *appsv1.Deployment) string {
+	// a nil replicas field means the default of 1
+	var desired int32 = 1
+	if deploy.Spec.Replicas != nil {
+		desired = *deploy.Spec.Replicas
+	}
+
+	return fmt.Sprintf("%d/%d ready", deploy.Status.ReadyReplicas, desired)
+}
+
+// Summarise a Service the way 'kubectl get svc' does: type, cluster IP and ports
+func determineServiceStatus(svc *v1.Service) string {
+	ports := make([]string, 0, len(svc.Spec.Ports))
+	for _, p := range svc.Spec.Ports {
+		if p.NodePort > 0 {
+			ports = append(ports, fmt.Sprintf("%d:%d/%s", p.Port, p.NodePort, p.Protocol))
+		} else {
+			ports = append(ports, fmt.Sprintf("%d/%s", p.Port, p.Protocol))
+		}
+	}
+	if len(ports) == 0 {
+		ports = append(ports, "<none>")
+	}
+
+	return fmt.Sprintf("%s %s %s", svc.Spec.Type, svc.Spec.ClusterIP, strings.Join(ports, ","))
+}
+
+// There's no schema for resources found through discovery, so fall back on the conventions most of them follow:
+// a status.phase field or a Ready condition
+func determineGenericStatus(u *unstructured.Unstructured) string {
+	if phase, found, _ := unstructured.NestedString(u.Object, "status", "phase"); found && phase != "" {
+		return phase
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok || cond["type"] != "Ready" {
+			continue
+		}
+		if cond["status"] == "True" {
+			return "Ready"
+		}
+		if reason, ok := cond["reason"].(string); ok && reason != "" {
+			return "NotReady: " + reason
+		}
+		return "NotReady"
+	}
+
+	return ""
+}
+
+func hasVerbs(verbs metav1.Verbs, required ...string) bool {
+	for _, r := range required {
+		found := false
+		for _, v := range verbs {
+			if v == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -3,26 +3,45 @@ package service
 import (
 	"autocli/model"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes"
 	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 	"testing"
+	"time"
 )
 
 func TestPing(t *testing.T) {
 	clients := make(map[string]kubernetes.Interface)
 	clients["test"] = testclient.NewSimpleClientset()
-	kc := NewKubeClient(clients)
+	kc := NewKubeClient(clients, nil)
 	createTestNodes(clients["test"], "test")
 	err := kc.Ping("test")
 	assert.NoError(t, err)
 }
 
+func TestPingWithoutNodes(t *testing.T) {
+	clients := make(map[string]kubernetes.Interface)
+	clients["test"] = testclient.NewSimpleClientset()
+	kc := NewKubeClient(clients, nil)
+	assert.NoError(t, kc.Ping("test"))
+}
+
 func TestPingError(t *testing.T) {
 	clients := make(map[string]kubernetes.Interface)
-	kc := NewKubeClient(clients)
+	kc := NewKubeClient(clients, nil)
 	err := kc.Ping("test")
 	assert.Error(t, err)
 }
@@ -30,12 +49,9 @@ func TestPingError(t *testing.T) {
 func TestGetNodes(t *testing.T) {
 	clients := make(map[string]kubernetes.Interface)
 	clients["test"] = testclient.NewSimpleClientset()
-	kc := NewKubeClient(clients)
+	kc := NewKubeClient(clients, nil)
 	createTestNodes(clients["test"], "test1", "test2")
-	res, err := kc.GetResources("test", "node")
-	if err != nil {
-		t.Errorf("unexpected error: %v", err)
-	}
+	res := listResources(t, kc, "test", "node")
 	expected := []model.KubeResource{
 		{
 			TypeMeta: model.TypeMeta{Kind: "node"},
@@ -45,6 +61,8 @@ func TestGetNodes(t *testing.T) {
 				ResourceVersion: "",
 				Status:          "Ready",
 				ContainerNames:  nil,
+				Fields:          map[string]string{"spec.unschedulable": "false"},
+				Node:            &model.NodeMeta{},
 			},
 		},
 		{
@@ -55,12 +73,642 @@ func TestGetNodes(t *testing.T) {
 				ResourceVersion: "",
 				Status:          "Ready",
 				ContainerNames:  nil,
+				Fields:          map[string]string{"spec.unschedulable": "false"},
+				Node:            &model.NodeMeta{},
 			},
 		},
 	}
 	assert.Equal(t, expected, res)
 }
 
+func TestGetDeployments(t *testing.T) {
+	clients := make(map[string]kubernetes.Interface)
+	clients["test"] = testclient.NewSimpleClientset()
+	kc := NewKubeClient(clients, nil)
+	var replicas int32 = 3
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "ns1",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+		Status: appsv1.DeploymentStatus{
+			ReadyReplicas: 2,
+		},
+	}
+	clients["test"].AppsV1().Deployments("ns1").Create(context.TODO(), deploy, metav1.CreateOptions{})
+
+	res := listResources(t, kc, "test", "deployment")
+	expected := []model.KubeResource{
+		{
+			TypeMeta: model.TypeMeta{Kind: "deployment"},
+			ResourceMeta: model.ResourceMeta{
+				Name:      "web",
+				Namespace: "ns1",
+				Status:    "2/3 ready",
+			},
+		},
+	}
+	assert.Equal(t, expected, res)
+}
+
+func TestGetServicesAndConfigMaps(t *testing.T) {
+	clients := make(map[string]kubernetes.Interface)
+	clients["test"] = testclient.NewSimpleClientset()
+	kc := NewKubeClient(clients, nil)
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "ns1"},
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeNodePort,
+			ClusterIP: "10.0.0.10",
+			Ports: []v1.ServicePort{
+				{Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP},
+				{Port: 53, Protocol: v1.ProtocolUDP},
+			},
+		},
+	}
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "ns1"},
+		Data:       map[string]string{"a": "1", "b": "2"},
+	}
+	clients["test"].CoreV1().Services("ns1").Create(context.TODO(), svc, metav1.CreateOptions{})
+	clients["test"].CoreV1().ConfigMaps("ns1").Create(context.TODO(), cm, metav1.CreateOptions{})
+
+	res := listResources(t, kc, "test", "service")
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "NodePort 10.0.0.10 80:30080/TCP,53/UDP", res[0].Status)
+
+	res = listResources(t, kc, "test", "configmap")
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "2 keys", res[0].Status)
+}
+
+func TestWatchPods(t *testing.T) {
+	clients := make(map[string]kubernetes.Interface)
+	clients["test"] = testclient.NewSimpleClientset()
+	kc := NewKubeClient(clients, nil)
+	createTestPods(clients["test"], "ns1", "pod1")
+
+	events := make(chan *model.ResourceEvent)
+	go kc.WatchResources("test", "pod", events)
+
+	// the initial listing is delivered as an ADDED event followed by the complete set
+	evt := <-events
+	assert.Equal(t, model.Added, evt.Type)
+	assert.Equal(t, "pod1", evt.Resource.Name)
+	evt = <-events
+	assert.Equal(t, model.Replaced, evt.Type)
+	assert.Equal(t, 1, len(evt.Resources))
+	assert.Equal(t, "ns1", evt.Resources[0].Namespace)
+
+	clients["test"].CoreV1().Pods("ns1").Delete(context.TODO(), "pod1", metav1.DeleteOptions{})
+	evt = <-events
+	assert.Equal(t, model.Deleted, evt.Type)
+	assert.Equal(t, "pod1", evt.Resource.Name)
+}
+
+func TestPodLabelsAndFields(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "ns1", Labels: map[string]string{"app": "checkout"}},
+		Spec:       v1.PodSpec{NodeName: "node1"},
+		Status:     v1.PodStatus{Phase: v1.PodPending},
+	}
+	res, ok := podToKubeResource(pod)
+	if assert.True(t, ok) {
+		assert.Equal(t, map[string]string{"app": "checkout"}, res.Labels)
+		assert.Equal(t, map[string]string{"spec.nodeName": "node1", "status.phase": "Pending"}, res.Fields)
+	}
+}
+
+func TestNodeMeta(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node1",
+			Labels: map[string]string{
+				"node-role.kubernetes.io/master":        "",
+				"node-role.kubernetes.io/control-plane": "",
+				"kubernetes.io/role":                    "etcd",
+				"kubernetes.io/hostname":                "node1",
+			},
+		},
+		Spec: v1.NodeSpec{
+			Unschedulable: true,
+			Taints: []v1.Taint{
+				{Key: "node-role.kubernetes.io/master", Effect: v1.TaintEffectNoSchedule},
+				{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoExecute},
+			},
+		},
+		Status: v1.NodeStatus{
+			NodeInfo: v1.NodeSystemInfo{KubeletVersion: "v1.19.2"},
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeMemoryPressure, Status: v1.ConditionTrue},
+				{Type: v1.NodeDiskPressure, Status: v1.ConditionFalse},
+				{Type: v1.NodePIDPressure, Status: v1.ConditionTrue},
+				{Type: v1.NodeReady, Status: v1.ConditionFalse},
+			},
+		},
+	}
+
+	res, ok := nodeToKubeResource(node)
+	if assert.True(t, ok) {
+		assert.Equal(t, "NotReady,SchedulingDisabled", res.Status)
+		assert.Equal(t, &model.NodeMeta{
+			Roles:          []string{"control-plane", "etcd", "master"},
+			KubeletVersion: "v1.19.2",
+			Unschedulable:  true,
+			Pressure:       []string{"MemoryPressure", "PIDPressure"},
+			Taints:         []string{"node-role.kubernetes.io/master:NoSchedule", "dedicated=gpu:NoExecute"},
+		}, res.Node)
+	}
+
+	node.Status.Conditions = nil
+	node.Spec.Unschedulable = false
+	assert.Equal(t, "Unknown", determineNodeStatus(node))
+}
+
+func TestPodStatus(t *testing.T) {
+	running := v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	crashing := v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+	completed := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Completed"}}
+	now := metav1.Now()
+
+	tests := []struct {
+		name     string
+		pod      v1.Pod
+		status   string
+		ready    int
+		restarts int32
+	}{
+		{
+			name: "running",
+			pod: v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning, ContainerStatuses: []v1.ContainerStatus{
+				{Ready: true, State: running, RestartCount: 1},
+				{Ready: true, State: running},
+			}}},
+			status: "Running", ready: 2, restarts: 1,
+		},
+		{
+			name: "crash looping",
+			pod: v1.Pod{Status: v1.PodStatus{Phase: v1.PodRunning, ContainerStatuses: []v1.ContainerStatus{
+				{Ready: true, State: running},
+				{State: crashing, RestartCount: 7},
+			}}},
+			status: "CrashLoopBackOff", ready: 1, restarts: 7,
+		},
+		{
+			name: "terminated without a reason",
+			pod: v1.Pod{Status: v1.PodStatus{Phase: v1.PodFailed, ContainerStatuses: []v1.ContainerStatus{
+				{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 137}}},
+			}}},
+			status: "ExitCode:137",
+		},
+		{
+			name: "sidecar completed",
+			pod: v1.Pod{Status: v1.PodStatus{
+				Phase:      v1.PodRunning,
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+				ContainerStatuses: []v1.ContainerStatus{
+					{Ready: true, State: running},
+					{State: completed},
+				}}},
+			status: "Running", ready: 1,
+		},
+		{
+			name: "initialising",
+			pod: v1.Pod{
+				Spec: v1.PodSpec{InitContainers: []v1.Container{{Name: "migrate"}, {Name: "seed"}}},
+				Status: v1.PodStatus{Phase: v1.PodPending, InitContainerStatuses: []v1.ContainerStatus{
+					{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}}, RestartCount: 1},
+					{State: running},
+				}}},
+			status: "Init:1/2", restarts: 1,
+		},
+		{
+			name: "init container crash looping",
+			pod: v1.Pod{
+				Spec: v1.PodSpec{InitContainers: []v1.Container{{Name: "migrate"}}},
+				Status: v1.PodStatus{Phase: v1.PodPending, InitContainerStatuses: []v1.ContainerStatus{
+					{State: crashing, RestartCount: 3},
+				}}},
+			status: "Init:CrashLoopBackOff", restarts: 3,
+		},
+		{
+			name:   "evicted",
+			pod:    v1.Pod{Status: v1.PodStatus{Phase: v1.PodFailed, Reason: "Evicted"}},
+			status: "Evicted",
+		},
+		{
+			name: "terminating",
+			pod: v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Status: v1.PodStatus{Phase: v1.PodRunning, ContainerStatuses: []v1.ContainerStatus{
+					{Ready: true, State: running},
+				}}},
+			status: "Terminating", ready: 1,
+		},
+		{
+			name: "on a lost node",
+			pod: v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Status:     v1.PodStatus{Phase: v1.PodRunning, Reason: "NodeLost"}},
+			status: "Unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, ready, restarts := podStatus(&tt.pod)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.ready, ready)
+			assert.Equal(t, tt.restarts, restarts)
+		})
+	}
+}
+
+func TestPodMeta(t *testing.T) {
+	controller := true
+	created := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "checkout-5d4f8-abcde",
+			Namespace:         "ns1",
+			CreationTimestamp: created,
+			Labels:            map[string]string{"pod-template-hash": "5d4f8"},
+			OwnerReferences:   []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "checkout-5d4f8", Controller: &controller}},
+		},
+		Spec: v1.PodSpec{
+			NodeName:       "node1",
+			InitContainers: []v1.Container{{Name: "init", Image: "busybox"}},
+			Containers:     []v1.Container{{Name: "app", Image: "checkout:1.2"}, {Name: "proxy", Image: "envoy:1.15"}},
+		},
+		Status: v1.PodStatus{
+			PodIP:             "10.0.0.7",
+			ContainerStatuses: []v1.ContainerStatus{{Name: "app", RestartCount: 2}, {Name: "proxy", RestartCount: 1}},
+		},
+	}
+
+	res, ok := podToKubeResource(pod)
+	if assert.True(t, ok) {
+		assert.Equal(t, created.Time, res.CreatedAt)
+		assert.Equal(t, &model.PodMeta{
+			Owner:      &model.OwnerRef{Kind: "Deployment", Name: "checkout"},
+			Node:       "node1",
+			IP:         "10.0.0.7",
+			Containers: 2,
+			Restarts:   3,
+			Images:     []string{"busybox", "checkout:1.2", "envoy:1.15"},
+		}, res.Pod)
+	}
+
+	// a ReplicaSet that isn't a Deployment's is the top-level owner
+	delete(pod.Labels, "pod-template-hash")
+	assert.Equal(t, &model.OwnerRef{Kind: "ReplicaSet", Name: "checkout-5d4f8"}, podOwner(pod))
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "StatefulSet", Name: "db", Controller: &controller}}
+	assert.Equal(t, &model.OwnerRef{Kind: "StatefulSet", Name: "db"}, podOwner(pod))
+	// a CronJob's Job is named after the minute it was scheduled for, shortly before its pods are created
+	scheduled := created.Add(-time.Minute).Unix() / 60
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "Job", Name: fmt.Sprintf("backup-%d", scheduled), Controller: &controller}}
+	assert.Equal(t, &model.OwnerRef{Kind: "CronJob", Name: "backup"}, podOwner(pod))
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "Job", Name: "migrate-2", Controller: &controller}}
+	assert.Equal(t, &model.OwnerRef{Kind: "Job", Name: "migrate-2"}, podOwner(pod))
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "Job", Name: "migrate", Controller: &controller}}
+	assert.Equal(t, &model.OwnerRef{Kind: "Job", Name: "migrate"}, podOwner(pod))
+	pod.OwnerReferences = nil
+	assert.Nil(t, podOwner(pod))
+}
+
+func TestAddRemoveContext(t *testing.T) {
+	kc := NewKubeClient(nil, nil)
+	client := testclient.NewSimpleClientset()
+	createTestPods(client, "ns1", "pod1")
+	kc.AddContext("test", client, nil, nil)
+
+	events := make(chan *model.ResourceEvent)
+	stopped := make(chan error)
+	go func() {
+		stopped <- kc.WatchResources("test", "pod", events)
+	}()
+	evt := <-events
+	assert.Equal(t, model.Added, evt.Type)
+	evt = <-events
+	assert.Equal(t, model.Replaced, evt.Type)
+
+	// removing the context stops its informers, and with them the watch
+	kc.RemoveContext("test")
+	assert.NoError(t, <-stopped)
+	assert.Error(t, kc.Ping("test"))
+}
+
+func TestWatchRetryAddsNoHandler(t *testing.T) {
+	client := testclient.NewSimpleClientset()
+	createTestPods(client, "ns1", "pod1")
+	kc := NewKubeClient(nil, nil)
+	kc.AddContext("test", client, nil, nil)
+	defer kc.RemoveContext("test")
+
+	events := make(chan *model.ResourceEvent)
+	go kc.WatchResources("test", "pod", events)
+	waitForReplaced(t, events)
+	// watching again, as a retry does, reuses the running informer
+	go kc.WatchResources("test", "pod", events)
+	waitForReplaced(t, events)
+
+	createTestPods(client, "ns1", "pod2")
+	added := 0
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case evt := <-events:
+			if evt.Type == model.Added && evt.Resource.Name == "pod2" {
+				added++
+			}
+		case <-timeout:
+			done = true
+		}
+	}
+	assert.Equal(t, 1, added)
+}
+
+func TestResumeFrom(t *testing.T) {
+	kc := NewKubeClient(nil, nil).(*DefaultKubeClient)
+	kc.AddContext("test", testclient.NewSimpleClientset(), nil, nil)
+	kc.ResumeFrom("test", "50")
+	defer kc.RemoveContext("test")
+
+	kc.mu.Lock()
+	ci, err := kc.contextInformers("test")
+	kc.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := kc.tweakListOptions(ci)
+
+	// the first list asks for the resourceVersion resumed from or later, in one go
+	options := metav1.ListOptions{ResourceVersion: "0", Limit: 500}
+	tweak(&options)
+	assert.Equal(t, metav1.ListOptions{ResourceVersion: "50"}, options)
+
+	// once listed the reflector carries on from its own resourceVersion
+	options = metav1.ListOptions{ResourceVersion: "60"}
+	tweak(&options)
+	assert.Equal(t, "60", options.ResourceVersion)
+
+	// after a failure the retry asks for any resourceVersion
+	r := cache.NewReflector(&cache.ListWatch{}, &v1.Pod{}, cache.NewStore(cache.MetaNamespaceKeyFunc), 0)
+	kc.onWatchError("test", ci, nil, ci.nsStopCh)(r, errors.New("Too large resource version"))
+	options = metav1.ListOptions{ResourceVersion: "0", Limit: 500}
+	tweak(&options)
+	assert.Equal(t, metav1.ListOptions{ResourceVersion: "0", Limit: 500}, options)
+}
+
+func TestDiscoveryClient(t *testing.T) {
+	discoveryClient := testclient.NewSimpleClientset()
+	discoveryClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "cert-manager.io/v1",
+			APIResources: []metav1.APIResource{{Name: "certificates", SingularName: "certificate", Namespaced: true, Kind: "Certificate", Verbs: metav1.Verbs{"list", "watch"}}},
+		},
+	}
+	kc := NewKubeClient(nil, nil)
+	kc.AddContext("test", testclient.NewSimpleClientset(), nil, discoveryClient.Discovery())
+
+	// discovery goes through the discovery client rather than the clientset
+	_, err := kc.ResolveKind("test", "certificate")
+	assert.NoError(t, err)
+	assert.NoError(t, kc.Ping("test"))
+	kc.RemoveContext("test")
+	assert.Error(t, kc.Ping("test"))
+}
+
+// Wait for the full listing, skipping the events that come before it
+// List a kind from the listing a watch of it starts with
+func listResources(t *testing.T, kc KubeClient, ctx, kind string) []model.KubeResource {
+	events := make(chan *model.ResourceEvent)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- kc.WatchResources(ctx, kind, events)
+	}()
+	for {
+		select {
+		case evt := <-events:
+			if evt.Type == model.Replaced {
+				return evt.Resources
+			}
+		case err := <-stopped:
+			t.Fatalf("watching %s failed: %v", kind, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the watch didn't list the %s resources", kind)
+		}
+	}
+}
+
+func waitForReplaced(t *testing.T, events chan *model.ResourceEvent) *model.ResourceEvent {
+	for {
+		select {
+		case evt := <-events:
+			if evt.Type == model.Replaced {
+				return evt
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the watch didn't list the resources")
+		}
+	}
+}
+
+func TestWatchNamespaces(t *testing.T) {
+	client := testclient.NewSimpleClientset()
+	createTestPods(client, "ns1", "pod1")
+	createTestPods(client, "ns2", "pod2")
+	createTestPods(client, "ns3", "pod3")
+	kc := NewKubeClient(nil, nil)
+	kc.AddContext("test", client, nil, nil)
+	kc.SetNamespaces("test", Namespaces{Watch: []string{"ns1", "ns2"}})
+	defer kc.RemoveContext("test")
+
+	events := make(chan *model.ResourceEvent)
+	go kc.WatchResources("test", "pod", events)
+	evt := waitForReplaced(t, events)
+	if assert.Equal(t, 2, len(evt.Resources)) {
+		assert.Equal(t, "pod1", evt.Resources[0].Name)
+		assert.Equal(t, "pod2", evt.Resources[1].Name)
+	}
+}
+
+func TestWatchForbiddenFallback(t *testing.T) {
+	client := testclient.NewSimpleClientset()
+	createTestPods(client, "ns1", "pod1")
+	createTestPods(client, "ns2", "pod2")
+	createTestNodes(client, "node1")
+	// the user may only list pods namespace by namespace
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == metav1.NamespaceAll {
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("not allowed"))
+		}
+		return false, nil, nil
+	})
+	kc := NewKubeClient(nil, nil)
+	kc.AddContext("test", client, nil, nil)
+	kc.SetNamespaces("test", Namespaces{Fallback: "ns2"})
+	defer kc.RemoveContext("test")
+
+	events := make(chan *model.ResourceEvent)
+	go kc.WatchResources("test", "pod", events)
+	evt := waitForReplaced(t, events)
+	if assert.Equal(t, 1, len(evt.Resources)) {
+		assert.Equal(t, "pod2", evt.Resources[0].Name)
+	}
+
+	// cluster-scoped kinds are still watched across the cluster
+	nodes := listResources(t, kc, "test", "node")
+	assert.Equal(t, 1, len(nodes))
+}
+
+func TestWatchForbiddenClusterScoped(t *testing.T) {
+	client := testclient.NewSimpleClientset()
+	createTestNodes(client, "node1")
+	// the user may only work in namespaces
+	client.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "", errors.New("not allowed"))
+	})
+	kc := NewKubeClient(nil, nil)
+	kc.AddContext("test", client, nil, nil)
+	kc.SetNamespaces("test", Namespaces{Fallback: "ns1"})
+	defer kc.RemoveContext("test")
+
+	// the watch gives up with the error rather than waiting for a sync that never comes
+	stopped := make(chan error)
+	go func() {
+		stopped <- kc.WatchResources("test", "node", make(chan *model.ResourceEvent))
+	}()
+	select {
+	case err := <-stopped:
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "forbidden")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watch didn't give up")
+	}
+}
+
+func TestWatchUnsupportedKind(t *testing.T) {
+	clients := make(map[string]kubernetes.Interface)
+	clients["test"] = testclient.NewSimpleClientset()
+	kc := NewKubeClient(clients, nil)
+	err := kc.WatchResources("test", "other", make(chan *model.ResourceEvent))
+	assert.Error(t, err)
+}
+
+func TestWatchDiscoveredKind(t *testing.T) {
+	clients := make(map[string]kubernetes.Interface)
+	dynamicClients := make(map[string]dynamic.Interface)
+	client := testclient.NewSimpleClientset()
+	client.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "cert-manager.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "certificates", SingularName: "certificate", ShortNames: []string{"cert", "certs"}, Namespaced: true, Kind: "Certificate", Verbs: metav1.Verbs{"get", "list", "watch"}},
+				{Name: "certificates/status", Namespaced: true, Kind: "Certificate", Verbs: metav1.Verbs{"get"}},
+			},
+		},
+	}
+	clients["test"] = client
+	cert := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"metadata":   map[string]interface{}{"name": "web-tls", "namespace": "ns1"},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "False", "reason": "Pending"},
+			},
+		},
+	}}
+	dynamicClients["test"] = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), cert)
+	kc := NewKubeClient(clients, dynamicClients)
+
+	for _, name := range []string{"cert", "certificates", "Certificate", "certificates.cert-manager.io"} {
+		rt, err := kc.ResolveKind("test", name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, "certificate", rt.Kind)
+		assert.Equal(t, "cert-manager.io", rt.Group)
+		assert.Equal(t, "v1", rt.Version)
+	}
+	_, err := kc.ResolveKind("test", "kafkatopic")
+	assert.Error(t, err)
+
+	res := listResources(t, kc, "test", "cert")
+	expected := []model.KubeResource{
+		{
+			TypeMeta: model.TypeMeta{Kind: "certificate", Group: "cert-manager.io", Version: "v1"},
+			ResourceMeta: model.ResourceMeta{
+				Name:      "web-tls",
+				Namespace: "ns1",
+				Status:    "NotReady: Pending",
+			},
+		},
+	}
+	assert.Equal(t, expected, res)
+}
+
+func TestWatchDiscoveredKindSameName(t *testing.T) {
+	client := testclient.NewSimpleClientset()
+	verbs := metav1.Verbs{"get", "list", "watch"}
+	client.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "events.k8s.io/v1",
+			APIResources: []metav1.APIResource{{Name: "events", SingularName: "event", Namespaced: true, Kind: "Event", Verbs: verbs}},
+		},
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "events", SingularName: "event", ShortNames: []string{"ev"}, Namespaced: true, Kind: "Event", Verbs: verbs}},
+		},
+	}
+	event := func(apiVersion, name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       "Event",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "ns1"},
+		}}
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), event("v1", "core"), event("events.k8s.io/v1", "new"))
+	kc := NewKubeClient(map[string]kubernetes.Interface{"test": client}, map[string]dynamic.Interface{"test": dynamicClient})
+
+	rt, err := kc.ResolveKind("test", "ev")
+	assert.NoError(t, err)
+	assert.Equal(t, "", rt.Group)
+	rt, err = kc.ResolveKind("test", "events.events.k8s.io")
+	assert.NoError(t, err)
+	assert.Equal(t, "events.k8s.io", rt.Group)
+
+	// each kind is watched as the resource type it was resolved to, even though the bare name resolves to another
+	res := listResources(t, kc, "test", WatchedKind(model.ResourceType{Kind: "event"}))
+	if assert.Equal(t, 1, len(res)) {
+		assert.Equal(t, "core", res[0].Name)
+		assert.Equal(t, "event", res[0].QualifiedKind())
+	}
+	res = listResources(t, kc, "test", WatchedKind(rt))
+	if assert.Equal(t, 1, len(res)) {
+		assert.Equal(t, "new", res[0].Name)
+		assert.Equal(t, "event.events.k8s.io", res[0].QualifiedKind())
+	}
+}
+
+func createTestPods(client kubernetes.Interface, ns string, names ...string) {
+	for _, name := range names {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodRunning,
+			},
+		}
+		client.CoreV1().Pods(ns).Create(context.TODO(), pod, metav1.CreateOptions{})
+	}
+}
+
 func createTestNodes(client kubernetes.Interface, names ...string) {
 	for _, name := range names {
 		node := &v1.Node{